@@ -0,0 +1,612 @@
+package engram
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// FeatureANNHNSWv1 is the SchemaInfo.Features flag set on files that
+// carry a persisted HNSW index, so DecodeWithANN knows to load it
+// instead of leaving cold reads to rebuild it from scratch.
+const FeatureANNHNSWv1 = "ann-hnsw-v1"
+
+// ANNOptions configures HNSW index construction and search.
+type ANNOptions struct {
+	// M is the max number of neighbors kept per node at layers above 0.
+	M int
+	// Mmax0 is the max number of neighbors kept per node at layer 0,
+	// conventionally 2*M.
+	Mmax0 int
+	// EfConstruction is the candidate list size used while inserting.
+	EfConstruction int
+	// EfSearch is the default candidate list size used while querying.
+	EfSearch int
+	// ML is the level-generation factor; new nodes are assigned layer
+	// floor(-ln(uniform()) * ML). Defaults to 1/ln(M).
+	ML float64
+}
+
+// DefaultANNOptions returns the HNSW parameters used when an index is
+// built lazily (on first Search) rather than via BuildANNIndex.
+func DefaultANNOptions() ANNOptions {
+	const m = 16
+	return ANNOptions{
+		M:              m,
+		Mmax0:          2 * m,
+		EfConstruction: 200,
+		EfSearch:       64,
+		ML:             1 / math.Log(m),
+	}
+}
+
+func normalizeANNOptions(opts ANNOptions) ANNOptions {
+	if opts.M < 2 {
+		opts.M = DefaultANNOptions().M
+	}
+	if opts.Mmax0 <= 0 {
+		opts.Mmax0 = 2 * opts.M
+	}
+	if opts.EfConstruction <= 0 {
+		opts.EfConstruction = 200
+	}
+	if opts.EfSearch <= 0 {
+		opts.EfSearch = 64
+	}
+	if opts.ML <= 0 {
+		opts.ML = 1 / math.Log(float64(opts.M))
+	}
+	return opts
+}
+
+// hnswNode is one indexed vector plus its per-layer neighbor lists.
+type hnswNode struct {
+	vector    []float32
+	neighbors [][]int32
+}
+
+// hnswIndex is an in-memory HNSW graph over a fixed set of embeddings,
+// identified by their MemoryNode.ID.
+type hnswIndex struct {
+	dim        int
+	opts       ANNOptions
+	nodes      []hnswNode
+	ids        []string
+	entryPoint int32
+	maxLevel   int
+}
+
+type annEntry struct {
+	id     string
+	vector []float32
+}
+
+func buildHNSW(entries []annEntry, opts ANNOptions) *hnswIndex {
+	opts = normalizeANNOptions(opts)
+
+	idx := &hnswIndex{
+		dim:        len(entries[0].vector),
+		opts:       opts,
+		nodes:      make([]hnswNode, len(entries)),
+		ids:        make([]string, len(entries)),
+		entryPoint: -1,
+		maxLevel:   -1,
+	}
+	for i, e := range entries {
+		idx.ids[i] = e.id
+		idx.nodes[i].vector = e.vector
+	}
+	for i := range entries {
+		idx.insert(int32(i))
+	}
+	return idx
+}
+
+func (idx *hnswIndex) distance(a, b []float32) float32 {
+	return 1 - cosineSimilarity(a, b)
+}
+
+func (idx *hnswIndex) neighborsAt(id int32, level int) []int32 {
+	neighbors := idx.nodes[id].neighbors
+	if level >= len(neighbors) {
+		return nil
+	}
+	return neighbors[level]
+}
+
+func (idx *hnswIndex) randomLevel() int {
+	level := int(math.Floor(-math.Log(rand.Float64()) * idx.opts.ML))
+	const maxLevel = 31 // generous cap against pathological draws
+	if level > maxLevel {
+		level = maxLevel
+	}
+	return level
+}
+
+// insert adds the already-stored vector for id into the graph.
+func (idx *hnswIndex) insert(id int32) {
+	vector := idx.nodes[id].vector
+	level := idx.randomLevel()
+	idx.nodes[id].neighbors = make([][]int32, level+1)
+
+	if idx.entryPoint == -1 {
+		idx.entryPoint = id
+		idx.maxLevel = level
+		return
+	}
+
+	ep := idx.entryPoint
+	curDist := idx.distance(vector, idx.nodes[ep].vector)
+	for lc := idx.maxLevel; lc > level; lc-- {
+		improved := true
+		for improved {
+			improved = false
+			for _, cand := range idx.neighborsAt(ep, lc) {
+				if d := idx.distance(vector, idx.nodes[cand].vector); d < curDist {
+					curDist, ep, improved = d, cand, true
+				}
+			}
+		}
+	}
+
+	entryPoints := []int32{ep}
+	top := level
+	if idx.maxLevel < top {
+		top = idx.maxLevel
+	}
+	for lc := top; lc >= 0; lc-- {
+		candidates := idx.searchLayer(vector, entryPoints, idx.opts.EfConstruction, lc)
+
+		maxM := idx.opts.M
+		if lc == 0 {
+			maxM = idx.opts.Mmax0
+		}
+		selected := idx.selectNeighborsHeuristic(vector, candidates, maxM)
+		idx.nodes[id].neighbors[lc] = append([]int32{}, selected...)
+		for _, nb := range selected {
+			idx.connect(nb, id, lc)
+		}
+		if len(candidates) > 0 {
+			entryPoints = candidates
+		}
+	}
+
+	if level > idx.maxLevel {
+		idx.maxLevel = level
+		idx.entryPoint = id
+	}
+}
+
+// connect adds a back-link from a to b at level, pruning a's neighbor
+// list back down to the level's max degree if it grew past it.
+func (idx *hnswIndex) connect(a, b int32, level int) {
+	node := &idx.nodes[a]
+	if level >= len(node.neighbors) {
+		grown := make([][]int32, level+1)
+		copy(grown, node.neighbors)
+		node.neighbors = grown
+	}
+	for _, existing := range node.neighbors[level] {
+		if existing == b {
+			return
+		}
+	}
+	node.neighbors[level] = append(node.neighbors[level], b)
+
+	maxM := idx.opts.M
+	if level == 0 {
+		maxM = idx.opts.Mmax0
+	}
+	if len(node.neighbors[level]) > maxM {
+		node.neighbors[level] = idx.selectNeighborsHeuristic(node.vector, node.neighbors[level], maxM)
+	}
+}
+
+// selectNeighborsHeuristic picks up to m candidates for q, preferring
+// diversity: a candidate is kept only if it is closer to q than to every
+// neighbor already selected, falling back to the closest remaining
+// candidates if the heuristic alone doesn't fill m slots.
+func (idx *hnswIndex) selectNeighborsHeuristic(q []float32, candidates []int32, m int) []int32 {
+	sorted := append([]int32{}, candidates...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return idx.distance(q, idx.nodes[sorted[i]].vector) < idx.distance(q, idx.nodes[sorted[j]].vector)
+	})
+
+	selected := make([]int32, 0, m)
+	for _, c := range sorted {
+		if len(selected) >= m {
+			break
+		}
+		cVec := idx.nodes[c].vector
+		keep := true
+		for _, s := range selected {
+			if idx.distance(cVec, idx.nodes[s].vector) < idx.distance(cVec, q) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			selected = append(selected, c)
+		}
+	}
+
+	if len(selected) < m {
+		for _, c := range sorted {
+			if len(selected) >= m {
+				break
+			}
+			alreadySelected := false
+			for _, s := range selected {
+				if s == c {
+					alreadySelected = true
+					break
+				}
+			}
+			if !alreadySelected {
+				selected = append(selected, c)
+			}
+		}
+	}
+	return selected
+}
+
+// query returns up to k internal node IDs nearest to q, ordered nearest
+// first.
+func (idx *hnswIndex) query(q []float32, k, ef int) []int32 {
+	if idx.entryPoint == -1 {
+		return nil
+	}
+
+	ep := idx.entryPoint
+	curDist := idx.distance(q, idx.nodes[ep].vector)
+	for lc := idx.maxLevel; lc > 0; lc-- {
+		improved := true
+		for improved {
+			improved = false
+			for _, cand := range idx.neighborsAt(ep, lc) {
+				if d := idx.distance(q, idx.nodes[cand].vector); d < curDist {
+					curDist, ep, improved = d, cand, true
+				}
+			}
+		}
+	}
+
+	if ef < k {
+		ef = k
+	}
+	candidates := idx.searchLayer(q, []int32{ep}, ef, 0)
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+// heapItem is a candidate node with its distance to the active query.
+type heapItem struct {
+	id   int32
+	dist float32
+}
+
+type minDistHeap []heapItem
+
+func (h minDistHeap) Len() int            { return len(h) }
+func (h minDistHeap) Less(i, j int) bool  { return h[i].dist < h[j].dist }
+func (h minDistHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minDistHeap) Push(x interface{}) { *h = append(*h, x.(heapItem)) }
+func (h *minDistHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+type maxDistHeap []heapItem
+
+func (h maxDistHeap) Len() int            { return len(h) }
+func (h maxDistHeap) Less(i, j int) bool  { return h[i].dist > h[j].dist }
+func (h maxDistHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxDistHeap) Push(x interface{}) { *h = append(*h, x.(heapItem)) }
+func (h *maxDistHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// searchLayer is the core HNSW greedy beam search at a single layer: it
+// keeps a candidate min-heap to expand from and a result max-heap capped
+// at ef, returning up to ef node IDs ordered nearest first.
+func (idx *hnswIndex) searchLayer(q []float32, entryPoints []int32, ef, level int) []int32 {
+	visited := make(map[int32]bool, ef*2)
+	candidates := &minDistHeap{}
+	results := &maxDistHeap{}
+
+	for _, ep := range entryPoints {
+		if visited[ep] {
+			continue
+		}
+		visited[ep] = true
+		d := idx.distance(q, idx.nodes[ep].vector)
+		heap.Push(candidates, heapItem{ep, d})
+		heap.Push(results, heapItem{ep, d})
+	}
+
+	for candidates.Len() > 0 {
+		nearest := (*candidates)[0]
+		if results.Len() >= ef && nearest.dist > (*results)[0].dist {
+			break
+		}
+		heap.Pop(candidates)
+
+		for _, neighbor := range idx.neighborsAt(nearest.id, level) {
+			if visited[neighbor] {
+				continue
+			}
+			visited[neighbor] = true
+			d := idx.distance(q, idx.nodes[neighbor].vector)
+
+			if results.Len() < ef {
+				heap.Push(candidates, heapItem{neighbor, d})
+				heap.Push(results, heapItem{neighbor, d})
+			} else if d < (*results)[0].dist {
+				heap.Push(candidates, heapItem{neighbor, d})
+				heap.Push(results, heapItem{neighbor, d})
+				heap.Pop(results)
+			}
+		}
+	}
+
+	out := make([]int32, results.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(results).(heapItem).id
+	}
+	return out
+}
+
+// BuildANNIndex eagerly builds an HNSW index over every node with a
+// non-empty, consistently-dimensioned Embedding, so later Search calls
+// use approximate nearest-neighbor lookup instead of a linear scan.
+func (t *MemoryTree) BuildANNIndex(opts ANNOptions) error {
+	entries := t.embeddingEntries()
+	if len(entries) == 0 {
+		return fmt.Errorf("engram: no embedded nodes to index")
+	}
+
+	t.annMu.Lock()
+	defer t.annMu.Unlock()
+	t.annIndex = buildHNSW(entries, opts)
+	return nil
+}
+
+// ensureANNIndex lazily builds an index with DefaultANNOptions on first
+// use, reusing it (or an index from BuildANNIndex/ImportANNIndex) on
+// subsequent calls. It returns nil if the tree has no embedded nodes.
+func (t *MemoryTree) ensureANNIndex() *hnswIndex {
+	t.annMu.Lock()
+	defer t.annMu.Unlock()
+	if t.annIndex != nil {
+		return t.annIndex
+	}
+	entries := t.embeddingEntries()
+	if len(entries) == 0 {
+		return nil
+	}
+	t.annIndex = buildHNSW(entries, DefaultANNOptions())
+	return t.annIndex
+}
+
+func (t *MemoryTree) embeddingEntries() []annEntry {
+	entries := make([]annEntry, 0, len(t.nodes))
+	dim := 0
+	for i := range t.nodes {
+		emb := t.nodes[i].Embedding
+		if len(emb) == 0 {
+			continue
+		}
+		if dim == 0 {
+			dim = len(emb)
+		}
+		if len(emb) != dim {
+			continue // skip nodes whose embedding doesn't match the index's dimension
+		}
+		entries = append(entries, annEntry{id: t.nodes[i].ID, vector: emb})
+	}
+	return entries
+}
+
+func (t *MemoryTree) searchANN(idx *hnswIndex, query []float32, limit int) []SearchResult {
+	ef := idx.opts.EfSearch
+	k := limit
+	if k <= 0 {
+		k = len(idx.ids)
+	}
+
+	ids := idx.query(query, k, ef)
+	results := make([]SearchResult, 0, len(ids))
+	for _, internalID := range ids {
+		node := t.byID[idx.ids[internalID]]
+		if node == nil {
+			continue
+		}
+		results = append(results, SearchResult{
+			Node:  node,
+			Score: cosineSimilarity(query, node.Embedding),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// persistedHNSW is the msgpack-serializable form of an hnswIndex, used
+// to round-trip an index through EncodeWithANN/DecodeWithANN.
+type persistedHNSW struct {
+	Dim            int         `msgpack:"dim"`
+	M              int         `msgpack:"m"`
+	Mmax0          int         `msgpack:"mmax0"`
+	EfConstruction int         `msgpack:"efConstruction"`
+	EfSearch       int         `msgpack:"efSearch"`
+	ML             float64     `msgpack:"ml"`
+	EntryPoint     int32       `msgpack:"entryPoint"`
+	MaxLevel       int         `msgpack:"maxLevel"`
+	IDs            []string    `msgpack:"ids"`
+	Vectors        [][]float32 `msgpack:"vectors"`
+	Neighbors      [][][]int32 `msgpack:"neighbors"`
+}
+
+// ExportANNIndex serializes the tree's current HNSW index, if any. It
+// returns a nil slice if no index has been built yet.
+func (t *MemoryTree) ExportANNIndex() ([]byte, error) {
+	t.annMu.Lock()
+	idx := t.annIndex
+	t.annMu.Unlock()
+	if idx == nil {
+		return nil, nil
+	}
+
+	p := persistedHNSW{
+		Dim: idx.dim, M: idx.opts.M, Mmax0: idx.opts.Mmax0,
+		EfConstruction: idx.opts.EfConstruction, EfSearch: idx.opts.EfSearch, ML: idx.opts.ML,
+		EntryPoint: idx.entryPoint, MaxLevel: idx.maxLevel, IDs: idx.ids,
+		Vectors:   make([][]float32, len(idx.nodes)),
+		Neighbors: make([][][]int32, len(idx.nodes)),
+	}
+	for i, n := range idx.nodes {
+		p.Vectors[i] = n.vector
+		p.Neighbors[i] = n.neighbors
+	}
+
+	data, err := msgpack.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ANN index: %w", err)
+	}
+	return data, nil
+}
+
+// ImportANNIndex loads a previously exported HNSW index, so Search can
+// use it without rebuilding from the tree's embeddings.
+func (t *MemoryTree) ImportANNIndex(data []byte) error {
+	var p persistedHNSW
+	if err := msgpack.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("failed to decode ANN index: %w", err)
+	}
+
+	idx := &hnswIndex{
+		dim:        p.Dim,
+		opts:       ANNOptions{M: p.M, Mmax0: p.Mmax0, EfConstruction: p.EfConstruction, EfSearch: p.EfSearch, ML: p.ML},
+		entryPoint: p.EntryPoint,
+		maxLevel:   p.MaxLevel,
+		ids:        p.IDs,
+		nodes:      make([]hnswNode, len(p.IDs)),
+	}
+	for i := range p.IDs {
+		idx.nodes[i] = hnswNode{vector: p.Vectors[i], neighbors: p.Neighbors[i]}
+	}
+
+	t.annMu.Lock()
+	defer t.annMu.Unlock()
+	t.annIndex = idx
+	return nil
+}
+
+var annFooterMagic = [4]byte{'E', 'N', 'G', 'A'}
+
+const annFooterSize = 16 // mainLength(8) + indexLength(4) + magic(4)
+
+// EncodeWithANN encodes file and, if tree has a built HNSW index,
+// appends it as a trailing section (after a regular Encode of file) and
+// sets the "ann-hnsw-v1" feature flag in the header so DecodeWithANN
+// knows to load it on the next read.
+func EncodeWithANN(file *EngramFile, tree *MemoryTree) ([]byte, error) {
+	indexBytes, err := tree.ExportANNIndex()
+	if err != nil {
+		return nil, err
+	}
+	if indexBytes == nil {
+		return Encode(file)
+	}
+
+	withFlag := *file
+	withFlag.Header.Schema.Features = appendFeature(file.Header.Schema.Features, FeatureANNHNSWv1)
+
+	mainBytes, err := Encode(&withFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(mainBytes)
+	buf.Write(indexBytes)
+
+	var footer [annFooterSize]byte
+	binary.BigEndian.PutUint64(footer[0:8], uint64(len(mainBytes)))
+	binary.BigEndian.PutUint32(footer[8:12], uint32(len(indexBytes)))
+	copy(footer[12:16], annFooterMagic[:])
+	buf.Write(footer[:])
+
+	return buf.Bytes(), nil
+}
+
+// DecodeWithANN decodes data and builds a MemoryTree over its nodes,
+// restoring a persisted HNSW index (if the trailing ANN section and
+// feature flag are present) instead of leaving the first Search to
+// rebuild one.
+func DecodeWithANN(data []byte) (*EngramFile, *MemoryTree, error) {
+	if len(data) >= annFooterSize {
+		footer := data[len(data)-annFooterSize:]
+		if bytes.Equal(footer[12:16], annFooterMagic[:]) {
+			mainLength := int64(binary.BigEndian.Uint64(footer[0:8]))
+			indexLength := int64(binary.BigEndian.Uint32(footer[8:12]))
+			total := int64(len(data))
+			if mainLength >= 0 && indexLength >= 0 && mainLength+indexLength+annFooterSize == total {
+				file, err := Decode(data[:mainLength])
+				if err != nil {
+					return nil, nil, err
+				}
+				tree := NewMemoryTree(file.Nodes)
+				tree.SetEmbeddingDim(file.Header.Schema.EmbeddingDim)
+				if hasFeature(file.Header.Schema.Features, FeatureANNHNSWv1) {
+					if err := tree.ImportANNIndex(data[mainLength : mainLength+indexLength]); err != nil {
+						return nil, nil, err
+					}
+				}
+				return file, tree, nil
+			}
+		}
+	}
+
+	file, err := Decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	tree := NewMemoryTree(file.Nodes)
+	tree.SetEmbeddingDim(file.Header.Schema.EmbeddingDim)
+	return file, tree, nil
+}
+
+func appendFeature(features []string, feature string) []string {
+	if hasFeature(features, feature) {
+		return features
+	}
+	return append(append([]string{}, features...), feature)
+}
+
+func hasFeature(features []string, feature string) bool {
+	for _, f := range features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
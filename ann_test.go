@@ -0,0 +1,173 @@
+package engram
+
+import (
+	"fmt"
+	"testing"
+)
+
+func gridNodes(n int) []MemoryNode {
+	nodes := make([]MemoryNode, n)
+	for i := 0; i < n; i++ {
+		angle := float32(i) / float32(n)
+		nodes[i] = MemoryNode{
+			ID:        fmt.Sprintf("node-%d", i),
+			Content:   fmt.Sprintf("content %d", i),
+			Embedding: []float32{angle, 1 - angle, float32(i % 3)},
+		}
+	}
+	return nodes
+}
+
+// highRecallOptions forces the HNSW search to visit nearly the whole
+// graph, so tests against small datasets reliably surface the exact
+// nearest neighbor despite the index being approximate by nature.
+func highRecallOptions() ANNOptions {
+	return ANNOptions{M: 16, Mmax0: 32, EfConstruction: 400, EfSearch: 400}
+}
+
+func TestSearchUsesANNIndexWhenBuilt(t *testing.T) {
+	nodes := gridNodes(200)
+	tree := NewMemoryTree(nodes)
+
+	if err := tree.BuildANNIndex(highRecallOptions()); err != nil {
+		t.Fatalf("BuildANNIndex failed: %v", err)
+	}
+
+	query := nodes[42].Embedding
+	results := tree.Search(query, 5)
+	if len(results) == 0 {
+		t.Fatal("expected at least one search result")
+	}
+	if results[0].Node.ID != "node-42" {
+		t.Errorf("expected exact match node-42 to rank first, got %s (score %f)", results[0].Node.ID, results[0].Score)
+	}
+}
+
+func TestSearchLazilyBuildsANNIndex(t *testing.T) {
+	nodes := gridNodes(50)
+	tree := NewMemoryTree(nodes)
+
+	if _, err := tree.ExportANNIndex(); err != nil {
+		t.Fatalf("ExportANNIndex failed: %v", err)
+	}
+
+	results := tree.Search(nodes[10].Embedding, 3)
+	if len(results) == 0 || results[0].Node.ID != "node-10" {
+		t.Fatalf("expected node-10 to rank first, got %+v", results)
+	}
+
+	data, err := tree.ExportANNIndex()
+	if err != nil {
+		t.Fatalf("ExportANNIndex failed: %v", err)
+	}
+	if data == nil {
+		t.Error("expected an index to have been built lazily by Search")
+	}
+}
+
+func TestBuildANNIndexNoEmbeddings(t *testing.T) {
+	tree := NewMemoryTree([]MemoryNode{{ID: "n1", Content: "no vector"}})
+	if err := tree.BuildANNIndex(DefaultANNOptions()); err == nil {
+		t.Error("expected an error building an ANN index with no embeddings")
+	}
+}
+
+func TestSearchFallsBackOnDimensionMismatch(t *testing.T) {
+	nodes := gridNodes(30)
+	tree := NewMemoryTree(nodes)
+	if err := tree.BuildANNIndex(highRecallOptions()); err != nil {
+		t.Fatalf("BuildANNIndex failed: %v", err)
+	}
+
+	// Query with a different dimension than the index was built with;
+	// Search should fall back to the linear scan (which scores every node
+	// 0, since cosineSimilarity short-circuits on length mismatch) rather
+	// than erroring.
+	results := tree.Search([]float32{1, 0}, 3)
+	for _, r := range results {
+		if r.Score != 0 {
+			t.Errorf("expected zero score from mismatched-dimension fallback, got %f", r.Score)
+		}
+	}
+}
+
+func TestSearchSkipsANNWhenSchemaDimMismatches(t *testing.T) {
+	nodes := gridNodes(20)
+	tree := NewMemoryTree(nodes)
+	tree.SetEmbeddingDim(5) // schema declares a dimension the data doesn't actually use
+
+	results := tree.Search(nodes[0].Embedding, 3)
+	if len(results) == 0 || results[0].Node.ID != "node-0" {
+		t.Fatalf("expected linear-scan fallback to still find node-0, got %+v", results)
+	}
+
+	exported, err := tree.ExportANNIndex()
+	if err != nil {
+		t.Fatalf("ExportANNIndex failed: %v", err)
+	}
+	if exported != nil {
+		t.Error("expected Search to skip building an ANN index when the query dimension doesn't match the declared schema embedding dimension")
+	}
+}
+
+func TestSearchUsesANNWhenSchemaDimMatches(t *testing.T) {
+	nodes := gridNodes(20)
+	tree := NewMemoryTree(nodes)
+	tree.SetEmbeddingDim(3) // matches gridNodes' embedding dimension
+
+	results := tree.Search(nodes[5].Embedding, 3)
+	if len(results) == 0 || results[0].Node.ID != "node-5" {
+		t.Fatalf("expected node-5 to rank first, got %+v", results)
+	}
+
+	exported, err := tree.ExportANNIndex()
+	if err != nil {
+		t.Fatalf("ExportANNIndex failed: %v", err)
+	}
+	if exported == nil {
+		t.Error("expected Search to lazily build an ANN index when the query dimension matches the declared schema embedding dimension")
+	}
+}
+
+func TestEncodeDecodeWithANNPersistsIndex(t *testing.T) {
+	nodes := gridNodes(100)
+	tree := NewMemoryTree(nodes)
+	if err := tree.BuildANNIndex(highRecallOptions()); err != nil {
+		t.Fatalf("BuildANNIndex failed: %v", err)
+	}
+
+	file := &EngramFile{
+		Header: EngramHeader{Version: "1.0"},
+		Nodes:  nodes,
+	}
+
+	data, err := EncodeWithANN(file, tree)
+	if err != nil {
+		t.Fatalf("EncodeWithANN failed: %v", err)
+	}
+
+	decodedFile, decodedTree, err := DecodeWithANN(data)
+	if err != nil {
+		t.Fatalf("DecodeWithANN failed: %v", err)
+	}
+	if len(decodedFile.Nodes) != len(nodes) {
+		t.Fatalf("decoded %d nodes, want %d", len(decodedFile.Nodes), len(nodes))
+	}
+	if !hasFeature(decodedFile.Header.Schema.Features, FeatureANNHNSWv1) {
+		t.Error("expected ann-hnsw-v1 feature flag to be set")
+	}
+
+	// The imported index should be usable without a rebuild.
+	exported, err := decodedTree.ExportANNIndex()
+	if err != nil {
+		t.Fatalf("ExportANNIndex failed: %v", err)
+	}
+	if exported == nil {
+		t.Fatal("expected decoded tree to already have an index")
+	}
+
+	results := decodedTree.Search(nodes[7].Embedding, 3)
+	if len(results) == 0 || results[0].Node.ID != "node-7" {
+		t.Errorf("expected node-7 to rank first, got %+v", results)
+	}
+}
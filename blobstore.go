@@ -0,0 +1,367 @@
+package engram
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// BlobStore resolves and stores the binary blobs referenced by
+// MemoryNode.Attachments, keyed by content-addressed CID.
+type BlobStore interface {
+	// Put stores the content of r and returns its CID and size.
+	Put(r io.Reader) (cid string, size int64, err error)
+	// Get opens the blob for cid for reading. Callers must Close it.
+	Get(cid string) (io.ReadCloser, error)
+	// Has reports whether cid is present in the store.
+	Has(cid string) (bool, error)
+}
+
+// ErrMissingBlob is returned when a MemoryNode references a CID that a
+// BlobStore cannot resolve.
+type ErrMissingBlob struct {
+	CID string
+}
+
+func (e *ErrMissingBlob) Error() string {
+	return fmt.Sprintf("engram: missing blob: %s", e.CID)
+}
+
+// sha256CID returns the "sha256-<hex>" multihash for data.
+func sha256CID(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256-" + hex.EncodeToString(sum[:])
+}
+
+// EncodeWithBlobs encodes file like EncodeWith, first validating that
+// every Attachment referenced by its nodes resolves through store. It
+// returns *ErrMissingBlob naming the first unresolved CID.
+func EncodeWithBlobs(file *EngramFile, kp KeyProvider, store BlobStore) ([]byte, error) {
+	if err := validateAttachments(file.Nodes, store); err != nil {
+		return nil, err
+	}
+	return EncodeWith(file, kp)
+}
+
+// DecodeWithBlobs decodes data like DecodeWith, then validates that every
+// Attachment referenced by the decoded nodes resolves through store. It
+// returns *ErrMissingBlob naming the first unresolved CID.
+func DecodeWithBlobs(data []byte, kp KeyProvider, store BlobStore) (*EngramFile, error) {
+	file, err := DecodeWith(data, kp)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAttachments(file.Nodes, store); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func validateAttachments(nodes []MemoryNode, store BlobStore) error {
+	for _, node := range nodes {
+		for _, att := range node.Attachments {
+			ok, err := store.Has(att.CID)
+			if err != nil {
+				return fmt.Errorf("failed to check blob %q: %w", att.CID, err)
+			}
+			if !ok {
+				return &ErrMissingBlob{CID: att.CID}
+			}
+		}
+	}
+	return nil
+}
+
+// FSBlobStore stores blobs as individual files under a sharded directory
+// tree: BaseDir/<cid[7:9]>/<cid[9:11]>/<cid>, mirroring the first four
+// hex digits of the hash portion of the CID (the "sha256-" prefix is
+// skipped when sharding so the directories fan out evenly).
+type FSBlobStore struct {
+	BaseDir string
+}
+
+// NewFSBlobStore creates a store rooted at baseDir, typically a sibling
+// of an Engram file (e.g. "<file>.blobs").
+func NewFSBlobStore(baseDir string) *FSBlobStore {
+	return &FSBlobStore{BaseDir: baseDir}
+}
+
+func (s *FSBlobStore) pathFor(cid string) string {
+	hash := cidHashPart(cid)
+	if len(hash) < 4 {
+		return filepath.Join(s.BaseDir, cid)
+	}
+	return filepath.Join(s.BaseDir, hash[:2], hash[2:4], cid)
+}
+
+func cidHashPart(cid string) string {
+	for i := 0; i < len(cid); i++ {
+		if cid[i] == '-' {
+			return cid[i+1:]
+		}
+	}
+	return cid
+}
+
+// Put implements BlobStore.
+func (s *FSBlobStore) Put(r io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(s.BaseDir, 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create blob store dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.BaseDir, "blob-*.tmp")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create temp blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), r)
+	closeErr := tmp.Close()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+	if closeErr != nil {
+		return "", 0, fmt.Errorf("failed to close temp blob: %w", closeErr)
+	}
+
+	cid := "sha256-" + hex.EncodeToString(hasher.Sum(nil))
+	path := s.pathFor(cid)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create blob shard dir: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, fmt.Errorf("failed to store blob: %w", err)
+	}
+	return cid, size, nil
+}
+
+// Get implements BlobStore.
+func (s *FSBlobStore) Get(cid string) (io.ReadCloser, error) {
+	f, err := os.Open(s.pathFor(cid))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &ErrMissingBlob{CID: cid}
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// Has implements BlobStore.
+func (s *FSBlobStore) Has(cid string) (bool, error) {
+	_, err := os.Stat(s.pathFor(cid))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// packEntry locates one blob within a PackedBlobStore's blob region.
+type packEntry struct {
+	CID    string `msgpack:"cid"`
+	Offset int64  `msgpack:"offset"`
+	Length int64  `msgpack:"length"`
+}
+
+var packMagic = []byte{'E', 'N', 'G', 'P', 'A', 'C', 'K', '1'}
+var packFooterMagic = [4]byte{'E', 'N', 'G', 'P'}
+
+const packFooterSize = 16 // indexOffset(8) + indexLength(4) + magic(4)
+
+// PackedBlobStore stores all of its blobs concatenated in a single file,
+// trailed by a msgpack index and a fixed footer, similar in spirit to a
+// git packfile. New blobs are appended after the existing blob region;
+// only the trailing index and footer are rewritten on each Put, so
+// existing blob bytes are never moved.
+type PackedBlobStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewPackedBlobStore opens (or prepares to create) a pack file at path.
+func NewPackedBlobStore(path string) *PackedBlobStore {
+	return &PackedBlobStore{path: path}
+}
+
+// Put implements BlobStore. Puts are deduplicated by CID: storing
+// identical content twice does not grow the pack file.
+func (s *PackedBlobStore) Put(r io.Reader) (string, int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read blob: %w", err)
+	}
+	cid := sha256CID(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, blobsEnd, err := s.loadEntriesLocked()
+	if err != nil {
+		return "", 0, err
+	}
+	for _, e := range entries {
+		if e.CID == cid {
+			return cid, e.Length, nil
+		}
+	}
+
+	f, err := os.OpenFile(s.path, os.O_RDWR, 0644)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open pack file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteAt(data, blobsEnd); err != nil {
+		return "", 0, fmt.Errorf("failed to append blob: %w", err)
+	}
+	entries = append(entries, packEntry{CID: cid, Offset: blobsEnd, Length: int64(len(data))})
+
+	if err := writePackIndex(f, entries, blobsEnd+int64(len(data))); err != nil {
+		return "", 0, err
+	}
+	return cid, int64(len(data)), nil
+}
+
+// Get implements BlobStore.
+func (s *PackedBlobStore) Get(cid string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	entries, _, err := s.loadEntriesLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if e.CID == cid {
+			f, err := os.Open(s.path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open pack file: %w", err)
+			}
+			return &sectionReadCloser{SectionReader: io.NewSectionReader(f, e.Offset, e.Length), f: f}, nil
+		}
+	}
+	return nil, &ErrMissingBlob{CID: cid}
+}
+
+// Has implements BlobStore.
+func (s *PackedBlobStore) Has(cid string) (bool, error) {
+	s.mu.Lock()
+	entries, _, err := s.loadEntriesLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		if e.CID == cid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// loadEntriesLocked reads the pack's current index (creating a fresh,
+// empty pack file if one doesn't exist yet) and returns its entries
+// along with the offset at which the blob region ends (i.e. where the
+// next blob should be appended). Callers must hold s.mu.
+func (s *PackedBlobStore) loadEntriesLocked() ([]packEntry, int64, error) {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		f, err := os.Create(s.path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to create pack file: %w", err)
+		}
+		defer f.Close()
+		if _, err := f.Write(packMagic); err != nil {
+			return nil, 0, fmt.Errorf("failed to write pack magic: %w", err)
+		}
+		return nil, int64(len(packMagic)), nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to stat pack file: %w", err)
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open pack file: %w", err)
+	}
+	defer f.Close()
+
+	size := info.Size()
+	if size == int64(len(packMagic)) {
+		return nil, size, nil // freshly created, no blobs yet
+	}
+	if size < int64(len(packMagic))+packFooterSize {
+		return nil, 0, fmt.Errorf("engram: pack file %q is truncated", s.path)
+	}
+
+	footer := make([]byte, packFooterSize)
+	if _, err := f.ReadAt(footer, size-packFooterSize); err != nil {
+		return nil, 0, fmt.Errorf("failed to read pack footer: %w", err)
+	}
+	if !bytes.Equal(footer[12:16], packFooterMagic[:]) {
+		return nil, 0, fmt.Errorf("engram: pack file %q has no valid footer", s.path)
+	}
+
+	indexOffset := int64(binary.BigEndian.Uint64(footer[0:8]))
+	indexLength := int64(binary.BigEndian.Uint32(footer[8:12]))
+	if indexOffset < int64(len(packMagic)) || indexOffset+indexLength+packFooterSize > size {
+		return nil, 0, fmt.Errorf("engram: pack file %q has an invalid index footer", s.path)
+	}
+
+	indexBytes := make([]byte, indexLength)
+	if _, err := f.ReadAt(indexBytes, indexOffset); err != nil {
+		return nil, 0, fmt.Errorf("failed to read pack index: %w", err)
+	}
+
+	var entries []packEntry
+	if err := msgpack.Unmarshal(indexBytes, &entries); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode pack index: %w", err)
+	}
+	return entries, indexOffset, nil
+}
+
+// writePackIndex truncates away any existing index/footer past blobsEnd
+// and writes a fresh one describing entries.
+func writePackIndex(f *os.File, entries []packEntry, blobsEnd int64) error {
+	indexBytes, err := msgpack.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode pack index: %w", err)
+	}
+
+	if err := f.Truncate(blobsEnd); err != nil {
+		return fmt.Errorf("failed to truncate pack file: %w", err)
+	}
+	if _, err := f.WriteAt(indexBytes, blobsEnd); err != nil {
+		return fmt.Errorf("failed to write pack index: %w", err)
+	}
+
+	var footer [packFooterSize]byte
+	binary.BigEndian.PutUint64(footer[0:8], uint64(blobsEnd))
+	binary.BigEndian.PutUint32(footer[8:12], uint32(len(indexBytes)))
+	copy(footer[12:16], packFooterMagic[:])
+	if _, err := f.WriteAt(footer[:], blobsEnd+int64(len(indexBytes))); err != nil {
+		return fmt.Errorf("failed to write pack footer: %w", err)
+	}
+	return nil
+}
+
+type sectionReadCloser struct {
+	*io.SectionReader
+	f *os.File
+}
+
+func (s *sectionReadCloser) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,124 @@
+package engram
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestFSBlobStoreRoundtrip(t *testing.T) {
+	store := NewFSBlobStore(filepath.Join(t.TempDir(), "blobs"))
+
+	content := []byte("hello blob")
+	cid, size, err := store.Put(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if size != int64(len(content)) {
+		t.Errorf("size: got %d, want %d", size, len(content))
+	}
+
+	ok, err := store.Has(cid)
+	if err != nil || !ok {
+		t.Fatalf("Has: got (%v, %v), want (true, nil)", ok, err)
+	}
+
+	rc, err := store.Get(cid)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer rc.Close()
+
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("content mismatch: got %q, want %q", got, content)
+	}
+
+	if ok, _ := store.Has("sha256-deadbeef"); ok {
+		t.Error("expected unknown CID to be absent")
+	}
+}
+
+func TestPackedBlobStoreRoundtrip(t *testing.T) {
+	store := NewPackedBlobStore(filepath.Join(t.TempDir(), "attachments.pack"))
+
+	cid1, _, err := store.Put(bytes.NewReader([]byte("blob one")))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	cid2, _, err := store.Put(bytes.NewReader([]byte("blob two, a bit longer")))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// Re-storing identical content should dedup rather than duplicate.
+	cid1Again, _, err := store.Put(bytes.NewReader([]byte("blob one")))
+	if err != nil {
+		t.Fatalf("Put (dedup) failed: %v", err)
+	}
+	if cid1Again != cid1 {
+		t.Errorf("dedup CID mismatch: got %s, want %s", cid1Again, cid1)
+	}
+
+	for cid, want := range map[string]string{cid1: "blob one", cid2: "blob two, a bit longer"} {
+		rc, err := store.Get(cid)
+		if err != nil {
+			t.Fatalf("Get(%s) failed: %v", cid, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("Get(%s): got %q, want %q", cid, got, want)
+		}
+	}
+}
+
+func TestEncodeDecodeWithBlobsMissing(t *testing.T) {
+	store := NewFSBlobStore(filepath.Join(t.TempDir(), "blobs"))
+
+	file := &EngramFile{
+		Header: EngramHeader{Version: "1.0"},
+		Nodes: []MemoryNode{
+			{ID: "n1", Content: "has an attachment", Attachments: []Attachment{
+				{CID: "sha256-notstored", MediaType: "image/png"},
+			}},
+		},
+	}
+
+	_, err := EncodeWithBlobs(file, nil, store)
+	var missing *ErrMissingBlob
+	if err == nil {
+		t.Fatal("expected ErrMissingBlob")
+	}
+	if !errors.As(err, &missing) || missing.CID != "sha256-notstored" {
+		t.Errorf("expected ErrMissingBlob for sha256-notstored, got %v", err)
+	}
+
+	// Store the blob, then it should succeed and round-trip through decode.
+	cid, _, err := store.Put(bytes.NewReader([]byte("png bytes")))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	file.Nodes[0].Attachments[0].CID = cid
+
+	data, err := EncodeWithBlobs(file, nil, store)
+	if err != nil {
+		t.Fatalf("EncodeWithBlobs failed: %v", err)
+	}
+
+	decoded, err := DecodeWithBlobs(data, nil, store)
+	if err != nil {
+		t.Fatalf("DecodeWithBlobs failed: %v", err)
+	}
+	if decoded.Nodes[0].Attachments[0].CID != cid {
+		t.Errorf("decoded attachment CID mismatch: got %s, want %s", decoded.Nodes[0].Attachments[0].CID, cid)
+	}
+}
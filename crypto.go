@@ -0,0 +1,235 @@
+package engram
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Supported values for SecurityInfo.Encryption.
+const (
+	EncryptionAESGCM           = "AES-256-GCM"
+	EncryptionChaCha20Poly1305 = "CHACHA20-POLY1305"
+	EncryptionAESCTRHMAC       = "AES-256-CTR-HMAC-SHA256"
+)
+
+// ErrDecryptionFailed is returned when a payload cannot be authenticated
+// or decrypted with the resolved key, e.g. on an AEAD tag mismatch.
+var ErrDecryptionFailed = errors.New("engram: decryption failed")
+
+// ErrKeyProviderRequired is returned when a file declares an encryption
+// algorithm but no KeyProvider was supplied to resolve its key.
+var ErrKeyProviderRequired = errors.New("engram: key provider required to decrypt payload")
+
+// ErrUnsupportedEncryption is returned for an unrecognized SecurityInfo.Encryption value.
+var ErrUnsupportedEncryption = errors.New("engram: unsupported encryption algorithm")
+
+const (
+	aesGCMNonceSize = 12
+	ctrIVSize       = aes.BlockSize
+	hmacSize        = sha256.Size
+)
+
+// KeyProvider resolves a KeyID (as stored in SecurityInfo.KeyID) to the raw
+// symmetric key bytes used to encrypt or decrypt a payload. Implementations
+// back this with environment variables, local files, or an external KMS.
+type KeyProvider interface {
+	ResolveKey(keyID string) ([]byte, error)
+}
+
+// EnvKeyProvider resolves keys from environment variables named
+// Prefix+keyID, holding the key as raw bytes in hex.
+type EnvKeyProvider struct {
+	Prefix string
+}
+
+// ResolveKey implements KeyProvider.
+func (p EnvKeyProvider) ResolveKey(keyID string) ([]byte, error) {
+	raw := os.Getenv(p.Prefix + keyID)
+	if raw == "" {
+		return nil, fmt.Errorf("engram: no key found in environment for key ID %q", keyID)
+	}
+	key, err := hex.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("engram: invalid hex key in environment for key ID %q: %w", keyID, err)
+	}
+	return key, nil
+}
+
+// StaticKeyProvider resolves keys from an in-memory map, keyed by KeyID.
+// It is primarily useful for tests and for callers that have already
+// loaded keys from a file or external KMS.
+type StaticKeyProvider map[string][]byte
+
+// ResolveKey implements KeyProvider.
+func (p StaticKeyProvider) ResolveKey(keyID string) ([]byte, error) {
+	key, ok := p[keyID]
+	if !ok {
+		return nil, fmt.Errorf("engram: no key registered for key ID %q", keyID)
+	}
+	return key, nil
+}
+
+// encryptPayload encrypts plaintext under the given algorithm and key,
+// returning the nonce/IV-prefixed ciphertext.
+func encryptPayload(algorithm string, key, plaintext []byte) ([]byte, error) {
+	switch algorithm {
+	case EncryptionAESGCM:
+		return aeadEncrypt(func(k []byte) (cipher.AEAD, error) {
+			block, err := aes.NewCipher(k)
+			if err != nil {
+				return nil, err
+			}
+			return cipher.NewGCM(block)
+		}, key, plaintext)
+	case EncryptionChaCha20Poly1305:
+		return aeadEncrypt(chacha20poly1305.New, key, plaintext)
+	case EncryptionAESCTRHMAC:
+		return ctrHMACEncrypt(key, plaintext)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncryption, algorithm)
+	}
+}
+
+// decryptPayload reverses encryptPayload, returning ErrDecryptionFailed on
+// any authentication failure so callers can distinguish it from I/O errors.
+func decryptPayload(algorithm string, key, ciphertext []byte) ([]byte, error) {
+	switch algorithm {
+	case EncryptionAESGCM:
+		return aeadDecrypt(func(k []byte) (cipher.AEAD, error) {
+			block, err := aes.NewCipher(k)
+			if err != nil {
+				return nil, err
+			}
+			return cipher.NewGCM(block)
+		}, key, ciphertext)
+	case EncryptionChaCha20Poly1305:
+		return aeadDecrypt(chacha20poly1305.New, key, ciphertext)
+	case EncryptionAESCTRHMAC:
+		return ctrHMACDecrypt(key, ciphertext)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncryption, algorithm)
+	}
+}
+
+func aeadEncrypt(newAEAD func([]byte) (cipher.AEAD, error), key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("engram: failed to init AEAD cipher: %w", err)
+	}
+
+	nonce := make([]byte, aeadNonceSize(aead))
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("engram: failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nil, nonce, plaintext, nil)
+	return append(nonce, sealed...), nil
+}
+
+func aeadDecrypt(newAEAD func([]byte) (cipher.AEAD, error), key, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("engram: failed to init AEAD cipher: %w", err)
+	}
+
+	nonceSize := aeadNonceSize(aead)
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("%w: ciphertext shorter than nonce", ErrDecryptionFailed)
+	}
+	nonce, sealed := data[:nonceSize], data[nonceSize:]
+
+	plaintext, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryptionFailed, err)
+	}
+	return plaintext, nil
+}
+
+func aeadNonceSize(aead cipher.AEAD) int {
+	if n := aead.NonceSize(); n > 0 {
+		return n
+	}
+	return aesGCMNonceSize
+}
+
+// ctrHMACEncrypt is an encrypt-then-MAC fallback (AES-256-CTR + HMAC-SHA256)
+// for Go environments without access to the newer AEAD suites.
+func ctrHMACEncrypt(key, plaintext []byte) ([]byte, error) {
+	encKey, macKey, err := splitCTRHMACKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("engram: failed to init AES cipher: %w", err)
+	}
+
+	iv := make([]byte, ctrIVSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, fmt.Errorf("engram: failed to generate IV: %w", err)
+	}
+
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, plaintext)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	tag := mac.Sum(nil)
+
+	out := make([]byte, 0, len(iv)+len(ciphertext)+len(tag))
+	out = append(out, iv...)
+	out = append(out, ciphertext...)
+	out = append(out, tag...)
+	return out, nil
+}
+
+func ctrHMACDecrypt(key, data []byte) ([]byte, error) {
+	encKey, macKey, err := splitCTRHMACKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < ctrIVSize+hmacSize {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrDecryptionFailed)
+	}
+	iv := data[:ctrIVSize]
+	ciphertext := data[ctrIVSize : len(data)-hmacSize]
+	gotTag := data[len(data)-hmacSize:]
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	wantTag := mac.Sum(nil)
+	if !hmac.Equal(gotTag, wantTag) {
+		return nil, fmt.Errorf("%w: HMAC tag mismatch", ErrDecryptionFailed)
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("engram: failed to init AES cipher: %w", err)
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext)
+	return plaintext, nil
+}
+
+// splitCTRHMACKey derives independent 32-byte encryption and MAC keys from
+// a single 64-byte input key so the two primitives never share key material.
+func splitCTRHMACKey(key []byte) (encKey, macKey []byte, err error) {
+	if len(key) != 64 {
+		return nil, nil, fmt.Errorf("engram: %s requires a 64-byte key (32 enc + 32 mac), got %d bytes", EncryptionAESCTRHMAC, len(key))
+	}
+	return key[:32], key[32:], nil
+}
@@ -0,0 +1,178 @@
+package engram
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeDecodeAESGCM(t *testing.T) {
+	kp := StaticKeyProvider{"k1": make([]byte, 32)}
+
+	file := &EngramFile{
+		Header: EngramHeader{
+			Version:  "1.0",
+			Security: SecurityInfo{Encryption: EncryptionAESGCM, KeyID: "k1"},
+		},
+		Nodes: []MemoryNode{{ID: "n1", Content: "secret content"}},
+	}
+
+	data, err := EncodeWith(file, kp)
+	if err != nil {
+		t.Fatalf("EncodeWith failed: %v", err)
+	}
+
+	decoded, err := DecodeWith(data, kp)
+	if err != nil {
+		t.Fatalf("DecodeWith failed: %v", err)
+	}
+	if len(decoded.Nodes) != 1 || decoded.Nodes[0].Content != "secret content" {
+		t.Errorf("decoded nodes mismatch: %+v", decoded.Nodes)
+	}
+
+	// Integrity covers ciphertext, so decoding without a key should fail
+	// only at the decryption step, not the integrity check.
+	decodedNoKey, err := DecodeWith(data, nil)
+	if decodedNoKey != nil {
+		t.Errorf("expected nil file without a key, got %+v", decodedNoKey)
+	}
+	if err != ErrKeyProviderRequired {
+		t.Errorf("expected ErrKeyProviderRequired, got: %v", err)
+	}
+}
+
+func TestEncodeDecodeChaCha20Poly1305(t *testing.T) {
+	kp := StaticKeyProvider{"k1": make([]byte, 32)}
+
+	file := &EngramFile{
+		Header: EngramHeader{
+			Security: SecurityInfo{Encryption: EncryptionChaCha20Poly1305, KeyID: "k1"},
+		},
+		Nodes: []MemoryNode{{ID: "n1", Content: "more secrets"}},
+	}
+
+	data, err := EncodeWith(file, kp)
+	if err != nil {
+		t.Fatalf("EncodeWith failed: %v", err)
+	}
+
+	decoded, err := DecodeWith(data, kp)
+	if err != nil {
+		t.Fatalf("DecodeWith failed: %v", err)
+	}
+	if decoded.Nodes[0].Content != "more secrets" {
+		t.Errorf("decoded content mismatch: %q", decoded.Nodes[0].Content)
+	}
+}
+
+func TestEncodeDecodeAESCTRHMAC(t *testing.T) {
+	kp := StaticKeyProvider{"k1": make([]byte, 64)}
+
+	file := &EngramFile{
+		Header: EngramHeader{
+			Security: SecurityInfo{Encryption: EncryptionAESCTRHMAC, KeyID: "k1"},
+		},
+		Nodes: []MemoryNode{{ID: "n1", Content: "fallback mode"}},
+	}
+
+	data, err := EncodeWith(file, kp)
+	if err != nil {
+		t.Fatalf("EncodeWith failed: %v", err)
+	}
+
+	decoded, err := DecodeWith(data, kp)
+	if err != nil {
+		t.Fatalf("DecodeWith failed: %v", err)
+	}
+	if decoded.Nodes[0].Content != "fallback mode" {
+		t.Errorf("decoded content mismatch: %q", decoded.Nodes[0].Content)
+	}
+}
+
+func TestDecodeTamperedCiphertext(t *testing.T) {
+	kp := StaticKeyProvider{"k1": make([]byte, 32)}
+
+	file := &EngramFile{
+		Header: EngramHeader{
+			Security: SecurityInfo{Encryption: EncryptionAESGCM, KeyID: "k1"},
+		},
+		Nodes: []MemoryNode{{ID: "n1", Content: "tamper me"}},
+	}
+
+	data, err := EncodeWith(file, kp)
+	if err != nil {
+		t.Fatalf("EncodeWith failed: %v", err)
+	}
+
+	corrupted := make([]byte, len(data))
+	copy(corrupted, data)
+	corrupted[len(corrupted)-1] ^= 0xFF // flip the last ciphertext byte
+
+	if _, err := DecodeWith(corrupted, kp); err == nil {
+		t.Fatal("expected an error decoding tampered ciphertext")
+	}
+}
+
+func TestEnvKeyProviderDecodesHex(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	t.Setenv("ENGRAM_KEY_k1", hex.EncodeToString(key))
+
+	p := EnvKeyProvider{Prefix: "ENGRAM_KEY_"}
+	resolved, err := p.ResolveKey("k1")
+	if err != nil {
+		t.Fatalf("ResolveKey failed: %v", err)
+	}
+	if !bytes.Equal(resolved, key) {
+		t.Errorf("ResolveKey = %x, want %x", resolved, key)
+	}
+}
+
+func TestEnvKeyProviderRejectsNonHex(t *testing.T) {
+	t.Setenv("ENGRAM_KEY_k1", "not-hex!")
+
+	p := EnvKeyProvider{Prefix: "ENGRAM_KEY_"}
+	if _, err := p.ResolveKey("k1"); err == nil {
+		t.Error("expected an error resolving a non-hex key")
+	}
+}
+
+func TestEnvKeyProviderMissing(t *testing.T) {
+	p := EnvKeyProvider{Prefix: "ENGRAM_KEY_MISSING_"}
+	if _, err := p.ResolveKey("nope"); err == nil {
+		t.Error("expected an error for an unset environment variable")
+	}
+}
+
+func TestVerifyIntegrityWithoutKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "secret.engram")
+
+	kp := StaticKeyProvider{"k1": make([]byte, 32)}
+	file := &EngramFile{
+		Header: EngramHeader{
+			Security: SecurityInfo{Encryption: EncryptionAESGCM, KeyID: "k1"},
+		},
+		Nodes: []MemoryNode{{ID: "n1", Content: "hidden"}},
+	}
+
+	data, err := EncodeWith(file, kp)
+	if err != nil {
+		t.Fatalf("EncodeWith failed: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	valid, err := VerifyIntegrity(path)
+	if err != nil {
+		t.Fatalf("VerifyIntegrity failed: %v", err)
+	}
+	if !valid {
+		t.Error("expected integrity to hold even without a key")
+	}
+}
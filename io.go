@@ -22,50 +22,101 @@ var ErrInvalidMagic = errors.New("invalid magic bytes: not an Engram file")
 // ErrIntegrityFailed is returned when the integrity check fails.
 var ErrIntegrityFailed = errors.New("integrity check failed: file may be corrupted")
 
-// ReadFile reads an Engram file from disk.
-func ReadFile(path string) (*EngramFile, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
-	return Decode(data)
-}
-
-// Decode decodes Engram data from bytes.
-func Decode(data []byte) (*EngramFile, error) {
-	// Check magic bytes
+// parseEnvelope splits raw Engram bytes into their decoded header and the
+// raw payload bytes that follow it (ciphertext, if the file is encrypted).
+// It is the shared first step of DecodeWith and Verify.
+func parseEnvelope(data []byte) (EngramHeader, []byte, error) {
 	if len(data) < 6 || !bytes.Equal(data[:6], MagicBytes) {
-		return nil, ErrInvalidMagic
+		return EngramHeader{}, nil, ErrInvalidMagic
 	}
 
-	// Skip magic bytes
 	reader := bytes.NewReader(data[6:])
 	decoder := msgpack.NewDecoder(reader)
 
-	// Decode header
 	var header EngramHeader
 	if err := decoder.Decode(&header); err != nil {
-		return nil, fmt.Errorf("failed to decode header: %w", err)
+		return EngramHeader{}, nil, fmt.Errorf("failed to decode header: %w", err)
 	}
 
-	// Read remaining bytes as payload
 	payloadStart := 6 + (len(data) - 6 - reader.Len())
-	payloadBytes := data[payloadStart:]
-
-	// Verify integrity if present
-	if header.Security.Integrity != "" {
-		hash := sha256.Sum256(payloadBytes)
-		computed := hex.EncodeToString(hash[:])
-		if computed != header.Security.Integrity {
-			return nil, ErrIntegrityFailed
-		}
+	return header, data[payloadStart:], nil
+}
+
+// ReadFile reads an Engram file from disk. If path was written to with a
+// Journal, any appended records are transparently replayed on top of the
+// base snapshot (last-write-wins by node ID, tombstones dropped); plain,
+// non-journaled files decode exactly as Decode would.
+func ReadFile(path string) (*EngramFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return decodeWithJournal(data)
+}
+
+// Decode decodes Engram data from bytes. If the file declares an
+// encryption algorithm, Decode returns ErrKeyProviderRequired once the
+// integrity check has passed; use DecodeWith to supply a KeyProvider.
+func Decode(data []byte) (*EngramFile, error) {
+	return DecodeWith(data, nil)
+}
+
+// DecodeWith decodes Engram data from bytes, using kp to resolve the
+// decryption key when the file's SecurityInfo.Encryption is set. kp may be
+// nil for unencrypted files. The integrity hash is computed over the
+// on-disk payload, encrypted or not. For encrypted files it is checked
+// before the key is resolved, so VerifyIntegrity keeps working even
+// without access to the key; for unencrypted files it is checked after
+// the node array has been decoded, as described below.
+//
+// Unencrypted payloads may be followed by trailing bytes that aren't part
+// of the node array, such as the index and footer EncodeWithOptions
+// appends for its indexed (v1.1) layout. Since a msgpack array is
+// self-delimiting, DecodeWith decodes just the array and hashes/returns
+// only the bytes it actually consumed, ignoring whatever trails it.
+func DecodeWith(data []byte, kp KeyProvider) (*EngramFile, error) {
+	header, payloadBytes, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
 	}
 
-	// Decode nodes from payload
 	var nodes []MemoryNode
-	payloadDecoder := msgpack.NewDecoder(bytes.NewReader(payloadBytes))
-	if err := payloadDecoder.Decode(&nodes); err != nil {
-		return nil, fmt.Errorf("failed to decode nodes: %w", err)
+
+	if header.Security.Encryption != "" {
+		if header.Security.Integrity != "" {
+			hash := sha256.Sum256(payloadBytes)
+			if hex.EncodeToString(hash[:]) != header.Security.Integrity {
+				return nil, ErrIntegrityFailed
+			}
+		}
+
+		if kp == nil {
+			return nil, ErrKeyProviderRequired
+		}
+		key, err := kp.ResolveKey(header.Security.KeyID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve decryption key: %w", err)
+		}
+		nodeBytes, err := decryptPayload(header.Security.Encryption, key, payloadBytes)
+		if err != nil {
+			return nil, err
+		}
+		if err := msgpack.Unmarshal(nodeBytes, &nodes); err != nil {
+			return nil, fmt.Errorf("failed to decode nodes: %w", err)
+		}
+	} else {
+		reader := bytes.NewReader(payloadBytes)
+		if err := msgpack.NewDecoder(reader).Decode(&nodes); err != nil {
+			return nil, fmt.Errorf("failed to decode nodes: %w", err)
+		}
+		consumed := len(payloadBytes) - reader.Len()
+
+		if header.Security.Integrity != "" {
+			hash := sha256.Sum256(payloadBytes[:consumed])
+			if hex.EncodeToString(hash[:]) != header.Security.Integrity {
+				return nil, ErrIntegrityFailed
+			}
+		}
 	}
 
 	return &EngramFile{
@@ -85,27 +136,38 @@ func WriteFile(path string, file *EngramFile) error {
 
 // Encode encodes an Engram file to bytes.
 func Encode(file *EngramFile) ([]byte, error) {
+	return EncodeWith(file, nil)
+}
+
+// EncodeWith encodes an Engram file to bytes, encrypting the node payload
+// when file.Header.Security.Encryption names a supported algorithm. kp
+// resolves the key for file.Header.Security.KeyID and may be nil when
+// Encryption is unset. The integrity hash is computed over the final
+// (possibly encrypted) payload.
+func EncodeWith(file *EngramFile, kp KeyProvider) ([]byte, error) {
 	// Encode payload first to compute integrity hash
 	payloadBytes, err := msgpack.Marshal(file.Nodes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode nodes: %w", err)
 	}
 
-	// Compute integrity hash
-	hash := sha256.Sum256(payloadBytes)
-	integrity := hex.EncodeToString(hash[:])
-
-	// Update header
 	header := file.Header
-	header.NodeCount = len(file.Nodes)
-	header.Modified = time.Now().UTC().Format(time.RFC3339)
-	if header.Created == "" {
-		header.Created = header.Modified
-	}
-	if header.Version == "" {
-		header.Version = "1.0"
+
+	if header.Security.Encryption != "" {
+		if kp == nil {
+			return nil, ErrKeyProviderRequired
+		}
+		key, err := kp.ResolveKey(header.Security.KeyID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve encryption key: %w", err)
+		}
+		payloadBytes, err = encryptPayload(header.Security.Encryption, key, payloadBytes)
+		if err != nil {
+			return nil, err
+		}
 	}
-	header.Security.Integrity = integrity
+
+	header = finalizeHeader(header, len(file.Nodes), payloadBytes)
 
 	// Encode header
 	headerBytes, err := msgpack.Marshal(header)
@@ -122,13 +184,48 @@ func Encode(file *EngramFile) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// VerifyIntegrity checks the integrity of an Engram file.
+// finalizeHeader stamps the bookkeeping fields Encode and its variants all
+// need to agree on: node count, timestamps, default version, and the
+// integrity hash over the final on-disk payload bytes.
+//
+// If header is already finalized for this exact payload (nodeCount and
+// the integrity hash both already match, as Sign leaves it after hashing
+// the payload it just signed), it is returned unchanged instead of being
+// re-stamped. Otherwise Modified keeps drifting on every Encode call,
+// which would change the header bytes out from under a signature that
+// was computed over the header Sign produced.
+func finalizeHeader(header EngramHeader, nodeCount int, payloadBytes []byte) EngramHeader {
+	hash := sha256.Sum256(payloadBytes)
+	integrity := hex.EncodeToString(hash[:])
+
+	if header.Modified != "" && header.NodeCount == nodeCount && header.Security.Integrity == integrity {
+		return header
+	}
+
+	header.NodeCount = nodeCount
+	header.Modified = time.Now().UTC().Format(time.RFC3339)
+	if header.Created == "" {
+		header.Created = header.Modified
+	}
+	if header.Version == "" {
+		header.Version = "1.0"
+	}
+	header.Security.Integrity = integrity
+	return header
+}
+
+// VerifyIntegrity checks the integrity of an Engram file. The integrity
+// hash covers the on-disk payload (ciphertext, for encrypted files), so
+// this succeeds even when the caller has no way to decrypt the nodes.
 func VerifyIntegrity(path string) (bool, error) {
 	_, err := ReadFile(path)
 	if err != nil {
 		if errors.Is(err, ErrIntegrityFailed) {
 			return false, nil
 		}
+		if errors.Is(err, ErrKeyProviderRequired) {
+			return true, nil
+		}
 		return false, err
 	}
 	return true, nil
@@ -0,0 +1,382 @@
+package engram
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Journal record types.
+const (
+	journalRecordPut       byte = 1
+	journalRecordTombstone byte = 2
+)
+
+// crc32cTable is the Castagnoli polynomial table used for per-record
+// checksums, the same variant used by common storage formats (e.g. iSCSI).
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Journal provides append-only incremental writes to an Engram file, so
+// small changes don't require rewriting the whole file. Each operation
+// is framed as [type(1) | length(4) | msgpack payload | crc32c(4)] and
+// appended directly after the file's existing payload; a sidecar
+// "<path>.log" records each record's offset and length as a secondary
+// trail for recovery tooling.
+type Journal struct {
+	path    string
+	logPath string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenJournal opens path for journaled appends, creating it (with an
+// empty base EngramFile) if it doesn't exist. If path already holds a
+// journal region trailing its base payload, OpenJournal validates every
+// record in it and truncates the file back to the last valid record
+// boundary, discarding any torn write left by a crash mid-append. Without
+// this, appendRecord's unconditional seek-to-end would land every future
+// append after the garbage instead of in its place, permanently burying
+// whatever was appended next behind bytes no reader will ever reach.
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat journal file: %w", err)
+	}
+	if info.Size() == 0 {
+		base, err := Encode(&EngramFile{Header: EngramHeader{Version: "1.0"}})
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if _, err := f.Write(base); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to write journal base: %w", err)
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	} else if err := truncateTornWrite(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Journal{path: path, logPath: path + ".log", f: f}, nil
+}
+
+// truncateTornWrite validates the journal records trailing f's base
+// payload and truncates f back to the last valid record boundary,
+// discarding a torn write left by a crash mid-append.
+func truncateTornWrite(f *os.File) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek journal file: %w", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("failed to read journal file: %w", err)
+	}
+
+	validLen, err := validJournalLength(data)
+	if err != nil {
+		return err
+	}
+	if validLen == len(data) {
+		return nil
+	}
+	if err := f.Truncate(int64(validLen)); err != nil {
+		return fmt.Errorf("failed to truncate torn journal write: %w", err)
+	}
+	return nil
+}
+
+// validJournalLength parses data as an Engram file with an optional
+// trailing journal region and returns the length data would have if any
+// torn write at the end of that region were discarded — i.e. the base
+// payload plus every complete, checksum-valid record before the tear.
+// Encrypted files are left untouched, matching decodeWithJournal's
+// behavior of falling back to Decode for them.
+func validJournalLength(data []byte) (int, error) {
+	header, rest, err := parseEnvelope(data)
+	if err != nil {
+		return 0, err
+	}
+	if header.Security.Encryption != "" {
+		return len(data), nil
+	}
+
+	reader := bytes.NewReader(rest)
+	if err := msgpack.NewDecoder(reader).Decode(new([]MemoryNode)); err != nil {
+		return 0, fmt.Errorf("failed to decode nodes: %w", err)
+	}
+	consumed := len(rest) - reader.Len()
+	journalRegion := rest[consumed:]
+
+	pos := 0
+	for pos < len(journalRegion) {
+		_, n, ok := parseJournalRecord(journalRegion[pos:])
+		if !ok {
+			break
+		}
+		pos += n
+	}
+
+	return len(data) - len(journalRegion) + pos, nil
+}
+
+// Close closes the underlying file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
+
+// AppendNode records n as a new (or updated) node.
+func (j *Journal) AppendNode(n MemoryNode) error {
+	payload, err := msgpack.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode node: %w", err)
+	}
+	_, err = j.appendRecord(journalRecordPut, payload)
+	return err
+}
+
+// UpdateNode records a replacement for an existing node. It is recorded
+// identically to AppendNode; ReadFile resolves the logical state
+// last-write-wins by node ID, so inserts and updates are interchangeable
+// at the journal level.
+func (j *Journal) UpdateNode(n MemoryNode) error {
+	return j.AppendNode(n)
+}
+
+// TombstoneNode records that id should be dropped when the journal is
+// replayed.
+func (j *Journal) TombstoneNode(id string) error {
+	payload, err := msgpack.Marshal(id)
+	if err != nil {
+		return fmt.Errorf("failed to encode tombstone: %w", err)
+	}
+	_, err = j.appendRecord(journalRecordTombstone, payload)
+	return err
+}
+
+// appendRecord writes one CRC-framed record at the end of the journal
+// file, fsyncs it, and mirrors its offset/length into the sidecar log.
+func (j *Journal) appendRecord(recType byte, payload []byte) (int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	offset, err := j.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to seek journal file: %w", err)
+	}
+
+	record := encodeJournalRecord(recType, payload)
+	if _, err := j.f.Write(record); err != nil {
+		return 0, fmt.Errorf("failed to append journal record: %w", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to fsync journal record: %w", err)
+	}
+
+	if err := appendSegmentLog(j.logPath, offset, int64(len(record))); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+// encodeJournalRecord frames one record as type(1) + length(4, BE) +
+// payload + crc32c(4, BE) over everything preceding the checksum.
+func encodeJournalRecord(recType byte, payload []byte) []byte {
+	record := make([]byte, 0, 1+4+len(payload)+4)
+	record = append(record, recType)
+
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(payload)))
+	record = append(record, lenBuf[:]...)
+	record = append(record, payload...)
+
+	var crcBuf [4]byte
+	binary.BigEndian.PutUint32(crcBuf[:], crc32.Checksum(record, crc32cTable))
+	return append(record, crcBuf[:]...)
+}
+
+func appendSegmentLog(logPath string, offset, length int64) error {
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "%d %d\n", offset, length); err != nil {
+		return fmt.Errorf("failed to append journal log entry: %w", err)
+	}
+	return f.Sync()
+}
+
+// decodeWithJournal parses data as an Engram file, replaying any journal
+// records appended after the base node payload. Files with no trailing
+// records (the common case) decode identically to Decode. Encrypted
+// payloads are not supported in journal mode, since the replay boundary
+// can't be located without first decrypting; those fall back to Decode.
+func decodeWithJournal(data []byte) (*EngramFile, error) {
+	header, rest, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.Security.Encryption != "" {
+		return Decode(data)
+	}
+
+	reader := bytes.NewReader(rest)
+	decoder := msgpack.NewDecoder(reader)
+	var nodes []MemoryNode
+	if err := decoder.Decode(&nodes); err != nil {
+		return nil, fmt.Errorf("failed to decode nodes: %w", err)
+	}
+	consumed := len(rest) - reader.Len()
+	basePayload := rest[:consumed]
+	journalRegion := rest[consumed:]
+
+	if header.Security.Integrity != "" {
+		hash := sha256.Sum256(basePayload)
+		if hex.EncodeToString(hash[:]) != header.Security.Integrity {
+			return nil, ErrIntegrityFailed
+		}
+	}
+
+	if len(journalRegion) > 0 {
+		nodes, err = applyJournalRecords(nodes, journalRegion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	header.NodeCount = len(nodes)
+	return &EngramFile{Header: header, Nodes: nodes}, nil
+}
+
+// applyJournalRecords replays CRC-framed records onto base, applying
+// puts and tombstones last-write-wins by node ID. A record whose CRC or
+// length doesn't check out marks the start of a torn write; replay stops
+// there rather than erroring, so a crash mid-append doesn't lose
+// everything written successfully before it.
+func applyJournalRecords(base []MemoryNode, data []byte) ([]MemoryNode, error) {
+	byID := make(map[string]MemoryNode, len(base))
+	order := make([]string, 0, len(base))
+	for _, n := range base {
+		byID[n.ID] = n
+		order = append(order, n.ID)
+	}
+
+	pos := 0
+	for pos < len(data) {
+		rec, consumed, ok := parseJournalRecord(data[pos:])
+		if !ok {
+			break // torn write: truncate back to the last valid boundary
+		}
+		pos += consumed
+
+		switch rec.recType {
+		case journalRecordPut:
+			var node MemoryNode
+			if err := msgpack.Unmarshal(rec.payload, &node); err != nil {
+				return nil, fmt.Errorf("failed to decode journaled node: %w", err)
+			}
+			if _, exists := byID[node.ID]; !exists {
+				order = append(order, node.ID)
+			}
+			byID[node.ID] = node
+		case journalRecordTombstone:
+			var id string
+			if err := msgpack.Unmarshal(rec.payload, &id); err != nil {
+				return nil, fmt.Errorf("failed to decode journaled tombstone: %w", err)
+			}
+			delete(byID, id)
+		default:
+			return nil, fmt.Errorf("engram: unknown journal record type %d", rec.recType)
+		}
+	}
+
+	nodes := make([]MemoryNode, 0, len(byID))
+	for _, id := range order {
+		if n, ok := byID[id]; ok {
+			nodes = append(nodes, n)
+			delete(byID, id) // an ID re-put after a tombstone appears twice in order
+		}
+	}
+	return nodes, nil
+}
+
+type journalRecord struct {
+	recType byte
+	payload []byte
+}
+
+// parseJournalRecord reads one record from the front of data, reporting
+// how many bytes it consumed. ok is false if data doesn't hold a
+// complete, checksum-valid record, which callers treat as the boundary
+// of a torn write.
+func parseJournalRecord(data []byte) (journalRecord, int, bool) {
+	const headerSize = 1 + 4
+	if len(data) < headerSize {
+		return journalRecord{}, 0, false
+	}
+
+	recType := data[0]
+	length := int(binary.BigEndian.Uint32(data[1:5]))
+	total := headerSize + length + 4
+	if length < 0 || total > len(data) {
+		return journalRecord{}, 0, false
+	}
+
+	payload := data[headerSize : headerSize+length]
+	wantCRC := binary.BigEndian.Uint32(data[headerSize+length : total])
+	gotCRC := crc32.Checksum(data[:headerSize+length], crc32cTable)
+	if gotCRC != wantCRC {
+		return journalRecord{}, 0, false
+	}
+
+	return journalRecord{recType: recType, payload: payload}, total, true
+}
+
+// Compact rewrites path in canonical (non-journaled) form: it replays
+// the journal, recomputes the integrity hash over the merged nodes, and
+// truncates the journal so future reads no longer need to replay it.
+// Any detached signatures are dropped, since they were computed over the
+// pre-compaction payload and signers must re-sign the compacted result.
+func Compact(path string) error {
+	file, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file.Header.Security.Signatures = nil
+
+	data, err := Encode(file)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write compacted file: %w", err)
+	}
+
+	logPath := path + ".log"
+	if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove journal log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package engram
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalAppendAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.engram")
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	if err := j.AppendNode(MemoryNode{ID: "n1", Content: "first"}); err != nil {
+		t.Fatalf("AppendNode failed: %v", err)
+	}
+	if err := j.AppendNode(MemoryNode{ID: "n2", Content: "second"}); err != nil {
+		t.Fatalf("AppendNode failed: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	file, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if len(file.Nodes) != 2 {
+		t.Fatalf("expected 2 nodes, got %d", len(file.Nodes))
+	}
+	if file.Nodes[0].ID != "n1" || file.Nodes[1].ID != "n2" {
+		t.Errorf("unexpected node order: %+v", file.Nodes)
+	}
+
+	if _, err := os.Stat(path + ".log"); err != nil {
+		t.Errorf("expected sidecar log file to exist: %v", err)
+	}
+}
+
+func TestJournalUpdateIsLastWriteWins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.engram")
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	if err := j.AppendNode(MemoryNode{ID: "n1", Content: "v1"}); err != nil {
+		t.Fatalf("AppendNode failed: %v", err)
+	}
+	if err := j.UpdateNode(MemoryNode{ID: "n1", Content: "v2"}); err != nil {
+		t.Fatalf("UpdateNode failed: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	file, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if len(file.Nodes) != 1 {
+		t.Fatalf("expected 1 node, got %d", len(file.Nodes))
+	}
+	if file.Nodes[0].Content != "v2" {
+		t.Errorf("expected last write to win, got content %q", file.Nodes[0].Content)
+	}
+}
+
+func TestJournalTombstoneDropsNode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.engram")
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	if err := j.AppendNode(MemoryNode{ID: "n1", Content: "keep"}); err != nil {
+		t.Fatalf("AppendNode failed: %v", err)
+	}
+	if err := j.AppendNode(MemoryNode{ID: "n2", Content: "drop me"}); err != nil {
+		t.Fatalf("AppendNode failed: %v", err)
+	}
+	if err := j.TombstoneNode("n2"); err != nil {
+		t.Fatalf("TombstoneNode failed: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	file, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if len(file.Nodes) != 1 || file.Nodes[0].ID != "n1" {
+		t.Fatalf("expected only n1 to survive, got %+v", file.Nodes)
+	}
+}
+
+func TestCompactRewritesCanonicalFileAndClearsJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.engram")
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	if err := j.AppendNode(MemoryNode{ID: "n1", Content: "first"}); err != nil {
+		t.Fatalf("AppendNode failed: %v", err)
+	}
+	if err := j.AppendNode(MemoryNode{ID: "n2", Content: "second"}); err != nil {
+		t.Fatalf("AppendNode failed: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if err := Compact(path); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	if _, err := os.Stat(path + ".log"); !os.IsNotExist(err) {
+		t.Errorf("expected sidecar log to be removed after Compact, err=%v", err)
+	}
+
+	file, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile after Compact failed: %v", err)
+	}
+	if len(file.Nodes) != 2 {
+		t.Fatalf("expected 2 nodes after compact, got %d", len(file.Nodes))
+	}
+
+	ok, err := VerifyIntegrity(path)
+	if err != nil {
+		t.Fatalf("VerifyIntegrity failed: %v", err)
+	}
+	if !ok {
+		t.Error("expected compacted file to pass integrity check")
+	}
+
+	j2, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("re-OpenJournal after Compact failed: %v", err)
+	}
+	if err := j2.AppendNode(MemoryNode{ID: "n3", Content: "third"}); err != nil {
+		t.Fatalf("AppendNode after Compact failed: %v", err)
+	}
+	if err := j2.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	file, err = ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile after further append failed: %v", err)
+	}
+	if len(file.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes after further append, got %d", len(file.Nodes))
+	}
+}
+
+func TestReadFileRecoversFromTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.engram")
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	if err := j.AppendNode(MemoryNode{ID: "n1", Content: "good record"}); err != nil {
+		t.Fatalf("AppendNode failed: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Simulate a crash mid-append: a partial record trails the file with
+	// no valid CRC.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("failed to open file for torn-write simulation: %v", err)
+	}
+	if _, err := f.Write([]byte{journalRecordPut, 0x00, 0x00, 0x00, 0x10, 'b', 'o', 'g', 'u', 's'}); err != nil {
+		t.Fatalf("failed to write torn record: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close file: %v", err)
+	}
+
+	file, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile should recover from a torn write, got error: %v", err)
+	}
+	if len(file.Nodes) != 1 || file.Nodes[0].ID != "n1" {
+		t.Fatalf("expected only the valid record to survive, got %+v", file.Nodes)
+	}
+}
+
+func TestOpenJournalTruncatesTornWriteSoAppendsAreRecoverable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.engram")
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	if err := j.AppendNode(MemoryNode{ID: "n1", Content: "good record"}); err != nil {
+		t.Fatalf("AppendNode failed: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Simulate a crash mid-append: a partial record trails the file with
+	// no valid CRC.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("failed to open file for torn-write simulation: %v", err)
+	}
+	if _, err := f.Write([]byte{journalRecordPut, 0x00, 0x00, 0x00, 0x10, 'b', 'o', 'g', 'u', 's'}); err != nil {
+		t.Fatalf("failed to write torn record: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close file: %v", err)
+	}
+
+	// Reopening the journal should truncate away the torn bytes, so this
+	// append lands right after n1 instead of behind permanently
+	// unreachable garbage.
+	j2, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("re-OpenJournal failed: %v", err)
+	}
+	if err := j2.AppendNode(MemoryNode{ID: "n2", Content: "second good record"}); err != nil {
+		t.Fatalf("AppendNode failed: %v", err)
+	}
+	if err := j2.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	file, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if len(file.Nodes) != 2 {
+		t.Fatalf("expected both records to survive the torn write, got %d nodes: %+v", len(file.Nodes), file.Nodes)
+	}
+	if file.Nodes[0].ID != "n1" || file.Nodes[1].ID != "n2" {
+		t.Errorf("unexpected node order: %+v", file.Nodes)
+	}
+}
@@ -0,0 +1,382 @@
+package engram
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// indexFooterMagic marks the trailing 16-byte footer of an indexed
+// Engram file so readers can distinguish it from the plain v1.0 layout.
+var indexFooterMagic = [4]byte{'E', 'N', 'G', 'X'}
+
+const footerSize = 16 // indexOffset(8) + indexLength(4) + magic(4)
+
+const (
+	defaultPageSize     = 64 * 1024
+	defaultPageCapacity = 32
+)
+
+// ErrNodeNotFound is returned by RandomReader.Open for an unknown node ID.
+var ErrNodeNotFound = errors.New("engram: node not found")
+
+// ErrIndexedEncryptionUnsupported is returned by EncodeWithOptions when
+// both Indexed and payload encryption are requested; per-node offsets
+// are only meaningful against the plaintext node payload.
+var ErrIndexedEncryptionUnsupported = errors.New("engram: indexed encoding does not support an encrypted payload")
+
+// EncodeOptions controls optional Encode behavior.
+type EncodeOptions struct {
+	// Indexed appends a trailing node index and footer (the v1.1 layout)
+	// so the file can later be opened with a RandomReader.
+	Indexed bool
+}
+
+// indexEntry locates one node's msgpack encoding within the payload.
+type indexEntry struct {
+	NodeID string `msgpack:"nodeId"`
+	Offset int64  `msgpack:"offset"`
+	Length int64  `msgpack:"length"`
+}
+
+// EncodeWithOptions encodes an Engram file like EncodeWith, additionally
+// honoring opts. With opts.Indexed, the payload is still a standard
+// msgpack array of nodes (so plain Decode keeps working), but each node
+// is marshalled individually so its absolute byte offset can be recorded
+// in a trailing msgpack index, itself located via a fixed 16-byte footer.
+func EncodeWithOptions(file *EngramFile, kp KeyProvider, opts EncodeOptions) ([]byte, error) {
+	if !opts.Indexed {
+		return EncodeWith(file, kp)
+	}
+	if file.Header.Security.Encryption != "" {
+		return nil, ErrIndexedEncryptionUnsupported
+	}
+
+	payloadBytes, entries, err := marshalIndexedNodes(file.Nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	header := finalizeHeader(file.Header, len(file.Nodes), payloadBytes)
+	headerBytes, err := msgpack.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode header: %w", err)
+	}
+
+	prefixLen := int64(len(MagicBytes) + len(headerBytes))
+	for i := range entries {
+		entries[i].Offset += prefixLen
+	}
+
+	indexBytes, err := msgpack.Marshal(entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode node index: %w", err)
+	}
+	indexOffset := prefixLen + int64(len(payloadBytes))
+
+	var buf bytes.Buffer
+	buf.Write(MagicBytes)
+	buf.Write(headerBytes)
+	buf.Write(payloadBytes)
+	buf.Write(indexBytes)
+
+	var footer [footerSize]byte
+	binary.BigEndian.PutUint64(footer[0:8], uint64(indexOffset))
+	binary.BigEndian.PutUint32(footer[8:12], uint32(len(indexBytes)))
+	copy(footer[12:16], indexFooterMagic[:])
+	buf.Write(footer[:])
+
+	return buf.Bytes(), nil
+}
+
+// marshalIndexedNodes msgpack-encodes nodes as a single array value (byte
+// for byte what msgpack.Marshal(nodes) would produce for a non-nil slice;
+// a nil slice is written as an empty array rather than msgpack nil),
+// while recording each node's offset and length relative to the start of
+// that array.
+func marshalIndexedNodes(nodes []MemoryNode) ([]byte, []indexEntry, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	if err := encoder.EncodeArrayLen(len(nodes)); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode node array header: %w", err)
+	}
+
+	entries := make([]indexEntry, len(nodes))
+	for i, node := range nodes {
+		start := buf.Len()
+		if err := encoder.Encode(node); err != nil {
+			return nil, nil, fmt.Errorf("failed to encode node %q: %w", node.ID, err)
+		}
+		entries[i] = indexEntry{
+			NodeID: node.ID,
+			Offset: int64(start),
+			Length: int64(buf.Len() - start),
+		}
+	}
+
+	return buf.Bytes(), entries, nil
+}
+
+// RandomReader provides random access to nodes in an Engram file without
+// decoding the whole thing up front. It understands both the indexed
+// (v1.1) layout and, as a fallback, plain files: opening a file without
+// the index footer transparently decodes it in full with Decode and
+// serves Open from memory instead; OpenRange returns an error for such
+// files.
+type RandomReader struct {
+	Header EngramHeader
+
+	entries map[string]indexEntry
+	order   []string
+	pages   *pageCache
+
+	fallback map[string]*MemoryNode
+}
+
+// NewRandomReader opens ra (of the given total size) for random access.
+func NewRandomReader(ra io.ReaderAt, size int64) (*RandomReader, error) {
+	if size >= footerSize {
+		footer := make([]byte, footerSize)
+		if _, err := ra.ReadAt(footer, size-footerSize); err != nil {
+			return nil, fmt.Errorf("failed to read footer: %w", err)
+		}
+		if bytes.Equal(footer[12:16], indexFooterMagic[:]) {
+			return newIndexedRandomReader(ra, size, footer)
+		}
+	}
+	return newFallbackRandomReader(ra, size)
+}
+
+func newIndexedRandomReader(ra io.ReaderAt, size int64, footer []byte) (*RandomReader, error) {
+	indexOffset := int64(binary.BigEndian.Uint64(footer[0:8]))
+	indexLength := int64(binary.BigEndian.Uint32(footer[8:12]))
+	if indexOffset < 0 || indexLength < 0 || indexOffset+indexLength > size {
+		return nil, fmt.Errorf("engram: invalid index footer bounds")
+	}
+
+	indexBytes := make([]byte, indexLength)
+	if _, err := ra.ReadAt(indexBytes, indexOffset); err != nil {
+		return nil, fmt.Errorf("failed to read node index: %w", err)
+	}
+
+	var entries []indexEntry
+	if err := msgpack.Unmarshal(indexBytes, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode node index: %w", err)
+	}
+
+	header, err := decodeHeaderAt(ra, size)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]indexEntry, len(entries))
+	order := make([]string, len(entries))
+	for i, e := range entries {
+		byID[e.NodeID] = e
+		order[i] = e.NodeID
+	}
+
+	return &RandomReader{
+		Header:  header,
+		entries: byID,
+		order:   order,
+		pages:   newPageCache(ra, defaultPageSize, defaultPageCapacity),
+	}, nil
+}
+
+func newFallbackRandomReader(ra io.ReaderAt, size int64) (*RandomReader, error) {
+	file, err := Decode(readAll(ra, size))
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*MemoryNode, len(file.Nodes))
+	for i := range file.Nodes {
+		byID[file.Nodes[i].ID] = &file.Nodes[i]
+	}
+
+	return &RandomReader{
+		Header:   file.Header,
+		fallback: byID,
+	}, nil
+}
+
+func readAll(ra io.ReaderAt, size int64) []byte {
+	buf := make([]byte, size)
+	_, _ = ra.ReadAt(buf, 0)
+	return buf
+}
+
+// decodeHeaderAt decodes just the magic bytes and header from ra,
+// without reading the (potentially large) payload that follows. This is
+// what lets NewRandomReader open an indexed file without materializing
+// its whole contents in memory.
+func decodeHeaderAt(ra io.ReaderAt, size int64) (EngramHeader, error) {
+	sr := io.NewSectionReader(ra, 0, size)
+
+	magic := make([]byte, len(MagicBytes))
+	if _, err := io.ReadFull(sr, magic); err != nil {
+		return EngramHeader{}, fmt.Errorf("failed to read magic bytes: %w", err)
+	}
+	if !bytes.Equal(magic, MagicBytes) {
+		return EngramHeader{}, ErrInvalidMagic
+	}
+
+	var header EngramHeader
+	if err := msgpack.NewDecoder(sr).Decode(&header); err != nil {
+		return EngramHeader{}, fmt.Errorf("failed to decode header: %w", err)
+	}
+	return header, nil
+}
+
+// Open returns the node with the given ID.
+func (r *RandomReader) Open(id string) (*MemoryNode, error) {
+	if r.fallback != nil {
+		node, ok := r.fallback[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrNodeNotFound, id)
+		}
+		return node, nil
+	}
+
+	entry, ok := r.entries[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNodeNotFound, id)
+	}
+	return r.readEntry(entry)
+}
+
+// OpenRange returns the nodes stored at positions [offset, offset+count)
+// in the file's original node order.
+func (r *RandomReader) OpenRange(offset, count int) ([]MemoryNode, error) {
+	if r.fallback != nil {
+		return nil, fmt.Errorf("engram: OpenRange requires an indexed file")
+	}
+	if offset < 0 || count < 0 || offset+count > len(r.order) {
+		return nil, fmt.Errorf("engram: range [%d, %d) out of bounds (have %d nodes)", offset, offset+count, len(r.order))
+	}
+
+	nodes := make([]MemoryNode, count)
+	for i := 0; i < count; i++ {
+		node, err := r.readEntry(r.entries[r.order[offset+i]])
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = *node
+	}
+	return nodes, nil
+}
+
+func (r *RandomReader) readEntry(entry indexEntry) (*MemoryNode, error) {
+	data, err := r.pages.ReadAt(entry.Offset, int(entry.Length))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node %q: %w", entry.NodeID, err)
+	}
+
+	var node MemoryNode
+	if err := msgpack.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("failed to decode node %q: %w", entry.NodeID, err)
+	}
+	return &node, nil
+}
+
+// pageCache is a small fixed-size-page LRU cache over an io.ReaderAt, so
+// RandomReader can serve reads from large files without loading them
+// fully into memory.
+type pageCache struct {
+	ra       io.ReaderAt
+	pageSize int64
+	cap      int
+
+	mu    sync.Mutex
+	pages map[int64]*list.Element
+	order *list.List
+}
+
+type cachedPage struct {
+	idx  int64
+	data []byte
+}
+
+func newPageCache(ra io.ReaderAt, pageSize int64, capacity int) *pageCache {
+	return &pageCache{
+		ra:       ra,
+		pageSize: pageSize,
+		cap:      capacity,
+		pages:    make(map[int64]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// ReadAt returns length bytes starting at offset, fetching and caching
+// whichever fixed-size pages they span.
+func (pc *pageCache) ReadAt(offset int64, length int) ([]byte, error) {
+	if length == 0 {
+		return nil, nil
+	}
+
+	out := make([]byte, length)
+	pos := 0
+	for pos < length {
+		cur := offset + int64(pos)
+		pageIdx := cur / pc.pageSize
+		withinPage := int(cur - pageIdx*pc.pageSize)
+
+		page, err := pc.getPage(pageIdx)
+		if err != nil {
+			return nil, err
+		}
+		if withinPage >= len(page) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		n := copy(out[pos:], page[withinPage:])
+		if n == 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		pos += n
+	}
+	return out, nil
+}
+
+func (pc *pageCache) getPage(idx int64) ([]byte, error) {
+	pc.mu.Lock()
+	if el, ok := pc.pages[idx]; ok {
+		pc.order.MoveToFront(el)
+		data := el.Value.(*cachedPage).data
+		pc.mu.Unlock()
+		return data, nil
+	}
+	pc.mu.Unlock()
+
+	buf := make([]byte, pc.pageSize)
+	n, err := pc.ra.ReadAt(buf, idx*pc.pageSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	buf = buf[:n]
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if el, ok := pc.pages[idx]; ok {
+		pc.order.MoveToFront(el)
+		return el.Value.(*cachedPage).data, nil
+	}
+
+	el := pc.order.PushFront(&cachedPage{idx: idx, data: buf})
+	pc.pages[idx] = el
+	if pc.order.Len() > pc.cap {
+		back := pc.order.Back()
+		if back != nil {
+			pc.order.Remove(back)
+			delete(pc.pages, back.Value.(*cachedPage).idx)
+		}
+	}
+	return buf, nil
+}
@@ -0,0 +1,104 @@
+package engram
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testNodes() []MemoryNode {
+	return []MemoryNode{
+		{ID: "n1", Content: "first"},
+		{ID: "n2", Content: "second", Tags: []string{"a", "b"}},
+		{ID: "n3", Content: "third"},
+	}
+}
+
+func TestRandomReaderIndexed(t *testing.T) {
+	file := &EngramFile{
+		Header: EngramHeader{Version: "1.0"},
+		Nodes:  testNodes(),
+	}
+
+	data, err := EncodeWithOptions(file, nil, EncodeOptions{Indexed: true})
+	if err != nil {
+		t.Fatalf("EncodeWithOptions failed: %v", err)
+	}
+
+	// An indexed file should still decode the normal way.
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode of indexed file failed: %v", err)
+	}
+	if len(decoded.Nodes) != 3 {
+		t.Fatalf("Decode: got %d nodes, want 3", len(decoded.Nodes))
+	}
+
+	rr, err := NewRandomReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("NewRandomReader failed: %v", err)
+	}
+
+	node, err := rr.Open("n2")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if node.Content != "second" || len(node.Tags) != 2 {
+		t.Errorf("Open: got %+v", node)
+	}
+
+	if _, err := rr.Open("missing"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("expected ErrNodeNotFound, got %v", err)
+	}
+
+	nodes, err := rr.OpenRange(1, 2)
+	if err != nil {
+		t.Fatalf("OpenRange failed: %v", err)
+	}
+	if len(nodes) != 2 || nodes[0].ID != "n2" || nodes[1].ID != "n3" {
+		t.Errorf("OpenRange: got %+v", nodes)
+	}
+}
+
+func TestRandomReaderFallback(t *testing.T) {
+	file := &EngramFile{
+		Header: EngramHeader{Version: "1.0"},
+		Nodes:  testNodes(),
+	}
+
+	data, err := Encode(file) // no index footer
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	rr, err := NewRandomReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("NewRandomReader failed: %v", err)
+	}
+
+	node, err := rr.Open("n3")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if node.Content != "third" {
+		t.Errorf("Open: got %+v", node)
+	}
+
+	if _, err := rr.OpenRange(0, 1); err == nil {
+		t.Error("expected OpenRange to fail for a non-indexed (fallback) file")
+	}
+}
+
+func TestEncodeWithOptionsIndexedEncryptionUnsupported(t *testing.T) {
+	file := &EngramFile{
+		Header: EngramHeader{
+			Security: SecurityInfo{Encryption: EncryptionAESGCM, KeyID: "k1"},
+		},
+		Nodes: testNodes(),
+	}
+
+	_, err := EncodeWithOptions(file, StaticKeyProvider{"k1": make([]byte, 32)}, EncodeOptions{Indexed: true})
+	if err != ErrIndexedEncryptionUnsupported {
+		t.Errorf("expected ErrIndexedEncryptionUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package engram
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// AlgorithmEd25519 is the only signing algorithm currently supported.
+const AlgorithmEd25519 = "Ed25519"
+
+// ErrEncryptedPayloadUnsigned is returned by Verify when the file's
+// payload is encrypted; signatures cover the plaintext node payload, so
+// they cannot be checked without first decrypting it.
+var ErrEncryptedPayloadUnsigned = fmt.Errorf("engram: cannot verify signatures over an encrypted payload")
+
+// KeyRing resolves a signer's KeyID to the Ed25519 public key used to
+// verify its signature. The second return value reports whether the
+// KeyID is known at all, so Verify can distinguish "unknown signer" from
+// "known signer, bad signature".
+type KeyRing interface {
+	PublicKey(keyID string) (ed25519.PublicKey, bool)
+}
+
+// StaticKeyRing is a KeyRing backed by an in-memory map, keyed by KeyID.
+type StaticKeyRing map[string]ed25519.PublicKey
+
+// PublicKey implements KeyRing.
+func (r StaticKeyRing) PublicKey(keyID string) (ed25519.PublicKey, bool) {
+	key, ok := r[keyID]
+	return key, ok
+}
+
+// VerifiedSigner reports the outcome of checking one signer's entry
+// against a KeyRing.
+type VerifiedSigner struct {
+	KeyID     string
+	Algorithm string
+	// Known is true if the keyring had a public key registered for KeyID.
+	Known bool
+	// Verified is true if Known and the signature validated.
+	Verified bool
+}
+
+// Sign adds a detached signature from priv, registered under keyID, to
+// file.Header.Security.Signatures. It signs magic || headerBytes ||
+// payloadBytes, where headerBytes excludes the Signatures field itself so
+// co-signers can sign independently of one another, and payloadBytes is
+// the plaintext msgpack encoding of file.Nodes. Sign also finalizes
+// file.Header the same way Encode would (timestamps, version, integrity,
+// node count) over that same payload, and leaves it finalized in place so
+// a later Encode/EncodeWith of the unmodified file writes back the exact
+// header bytes that were signed instead of re-stamping Modified.
+//
+// Signing an encrypted payload is not supported: Sign returns
+// ErrEncryptedPayloadUnsigned when file.Header.Security.Encryption is
+// set, and Verify rejects encrypted files the same way.
+func Sign(file *EngramFile, keyID string, priv ed25519.PrivateKey) error {
+	if file.Header.Security.Encryption != "" {
+		return ErrEncryptedPayloadUnsigned
+	}
+
+	payloadBytes, err := msgpack.Marshal(file.Nodes)
+	if err != nil {
+		return fmt.Errorf("failed to encode nodes: %w", err)
+	}
+
+	file.Header = finalizeHeader(file.Header, len(file.Nodes), payloadBytes)
+
+	message, err := signingMessage(file.Header, payloadBytes)
+	if err != nil {
+		return err
+	}
+
+	sig := ed25519.Sign(priv, message)
+	file.Header.Security.Signatures = append(file.Header.Security.Signatures, Signature{
+		KeyID:     keyID,
+		Algorithm: AlgorithmEd25519,
+		Signature: sig,
+	})
+	return nil
+}
+
+// Verify checks every detached signature in an encoded Engram file's
+// header against keyring, returning one VerifiedSigner per entry.
+// Verify never fails because a signer's key is missing from the
+// keyring or because a signature doesn't validate — those surface as
+// Known/Verified being false so callers can enforce their own policy
+// (e.g. require at least one verified signer from a trusted set).
+func Verify(data []byte, keyring KeyRing) ([]VerifiedSigner, error) {
+	header, payloadBytes, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.Security.Encryption != "" {
+		return nil, ErrEncryptedPayloadUnsigned
+	}
+
+	signers := header.Security.Signatures
+	if len(signers) == 0 {
+		return nil, nil
+	}
+
+	message, err := signingMessage(header, payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]VerifiedSigner, 0, len(signers))
+	for _, s := range signers {
+		pub, known := keyring.PublicKey(s.KeyID)
+		verified := known && len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, message, s.Signature)
+		results = append(results, VerifiedSigner{
+			KeyID:     s.KeyID,
+			Algorithm: s.Algorithm,
+			Known:     known,
+			Verified:  verified,
+		})
+	}
+	return results, nil
+}
+
+// DecodeAndVerify decodes data like Decode, and additionally checks any
+// detached signatures in its header against keyring, returning one
+// VerifiedSigner per signer alongside the decoded file. Decode alone
+// never reports signature state, and Verify alone never returns the
+// decoded nodes, so callers that need both no longer have to call them
+// separately and keep the results in sync by hand. As with Verify, a
+// missing or invalid signer key never fails the call — it surfaces as
+// Known/Verified being false so callers can enforce their own policy.
+// A file with no signatures at all returns a nil Signers slice.
+func DecodeAndVerify(data []byte, keyring KeyRing) (file *EngramFile, signers []VerifiedSigner, err error) {
+	file, err = Decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signers, err = Verify(data, keyring)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, signers, nil
+}
+
+// signingMessage builds the canonical bytes signers operate over: the
+// magic prefix, the header with its Signatures field cleared, and the
+// node payload. Clearing Signatures lets every co-signer sign the same
+// message regardless of how many other signatures are already present.
+func signingMessage(header EngramHeader, payloadBytes []byte) ([]byte, error) {
+	header.Security.Signatures = nil
+	headerBytes, err := msgpack.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode header: %w", err)
+	}
+
+	message := make([]byte, 0, len(MagicBytes)+len(headerBytes)+len(payloadBytes))
+	message = append(message, MagicBytes...)
+	message = append(message, headerBytes...)
+	message = append(message, payloadBytes...)
+	return message, nil
+}
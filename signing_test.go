@@ -0,0 +1,206 @@
+package engram
+
+import (
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestSignVerifyHappyPath(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	file := &EngramFile{
+		Header: EngramHeader{Version: "1.0"},
+		Nodes:  []MemoryNode{{ID: "n1", Content: "signed content"}},
+	}
+
+	if err := Sign(file, "author", priv); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	data, err := Encode(file)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	keyring := StaticKeyRing{"author": pub}
+	signers, err := Verify(data, keyring)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(signers) != 1 {
+		t.Fatalf("got %d signers, want 1", len(signers))
+	}
+	if !signers[0].Known || !signers[0].Verified {
+		t.Errorf("expected known+verified signer, got %+v", signers[0])
+	}
+}
+
+func TestVerifyTamperedPayload(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	file := &EngramFile{
+		Header: EngramHeader{Version: "1.0"},
+		Nodes:  []MemoryNode{{ID: "n1", Content: "original"}},
+	}
+	if err := Sign(file, "author", priv); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	// Tamper with the in-memory nodes after signing, then re-encode
+	// (skipping a re-sign) so the signature no longer matches.
+	file.Nodes[0].Content = "tampered"
+	data, err := Encode(file)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	signers, err := Verify(data, StaticKeyRing{"author": pub})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(signers) != 1 || signers[0].Verified {
+		t.Errorf("expected signature to fail verification, got %+v", signers)
+	}
+}
+
+func TestVerifyUnknownKeyID(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	file := &EngramFile{
+		Header: EngramHeader{Version: "1.0"},
+		Nodes:  []MemoryNode{{ID: "n1", Content: "hello"}},
+	}
+	if err := Sign(file, "author", priv); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	data, err := Encode(file)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	signers, err := Verify(data, StaticKeyRing{})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(signers) != 1 || signers[0].Known || signers[0].Verified {
+		t.Errorf("expected unknown, unverified signer, got %+v", signers)
+	}
+}
+
+func TestDecodeAndVerifyHappyPath(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	file := &EngramFile{
+		Header: EngramHeader{Version: "1.0"},
+		Nodes:  []MemoryNode{{ID: "n1", Content: "signed content"}},
+	}
+	if err := Sign(file, "author", priv); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	data, err := Encode(file)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	decoded, signers, err := DecodeAndVerify(data, StaticKeyRing{"author": pub})
+	if err != nil {
+		t.Fatalf("DecodeAndVerify failed: %v", err)
+	}
+	if len(decoded.Nodes) != 1 || decoded.Nodes[0].ID != "n1" {
+		t.Fatalf("unexpected decoded nodes: %+v", decoded.Nodes)
+	}
+	if len(signers) != 1 || !signers[0].Known || !signers[0].Verified {
+		t.Errorf("expected known+verified signer, got %+v", signers)
+	}
+}
+
+func TestDecodeAndVerifyUnsignedFile(t *testing.T) {
+	file := &EngramFile{
+		Header: EngramHeader{Version: "1.0"},
+		Nodes:  []MemoryNode{{ID: "n1", Content: "no signatures here"}},
+	}
+
+	data, err := Encode(file)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	decoded, signers, err := DecodeAndVerify(data, StaticKeyRing{})
+	if err != nil {
+		t.Fatalf("DecodeAndVerify failed: %v", err)
+	}
+	if len(decoded.Nodes) != 1 {
+		t.Fatalf("unexpected decoded nodes: %+v", decoded.Nodes)
+	}
+	if signers != nil {
+		t.Errorf("expected nil signers for an unsigned file, got %+v", signers)
+	}
+}
+
+func TestVerifyMixedValidAndInvalidSigners(t *testing.T) {
+	authorPub, authorPriv, _ := ed25519.GenerateKey(nil)
+	publisherPub, publisherPriv, _ := ed25519.GenerateKey(nil)
+	_ = publisherPub
+
+	file := &EngramFile{
+		Header: EngramHeader{Version: "1.0"},
+		Nodes:  []MemoryNode{{ID: "n1", Content: "co-signed"}},
+	}
+
+	if err := Sign(file, "author", authorPriv); err != nil {
+		t.Fatalf("Sign (author) failed: %v", err)
+	}
+	if err := Sign(file, "publisher", publisherPriv); err != nil {
+		t.Fatalf("Sign (publisher) failed: %v", err)
+	}
+
+	data, err := Encode(file)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	// Register the wrong public key for "publisher" so it's a known
+	// signer whose signature nonetheless fails to validate.
+	keyring := StaticKeyRing{
+		"author":    authorPub,
+		"publisher": authorPub, // wrong key on purpose
+	}
+
+	signers, err := Verify(data, keyring)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(signers) != 2 {
+		t.Fatalf("got %d signers, want 2", len(signers))
+	}
+
+	var sawValidAuthor, sawInvalidPublisher bool
+	for _, s := range signers {
+		switch s.KeyID {
+		case "author":
+			sawValidAuthor = s.Known && s.Verified
+		case "publisher":
+			sawInvalidPublisher = s.Known && !s.Verified
+		}
+	}
+	if !sawValidAuthor {
+		t.Error("expected author signature to verify")
+	}
+	if !sawInvalidPublisher {
+		t.Error("expected publisher signature (checked against the wrong key) to fail verification")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"math"
 	"sort"
 	"strings"
+	"sync"
 )
 
 // MemoryTree provides navigation and search over memory nodes.
@@ -12,6 +13,17 @@ type MemoryTree struct {
 	byID     map[string]*MemoryNode
 	byTag    map[string][]*MemoryNode
 	children map[string][]*MemoryNode
+
+	// annMu guards annIndex, which is built lazily on first vector
+	// Search, eagerly via BuildANNIndex, or restored via ImportANNIndex.
+	annMu    sync.Mutex
+	annIndex *hnswIndex
+
+	// embeddingDim is the schema's declared embedding dimension
+	// (SchemaInfo.EmbeddingDim), set via SetEmbeddingDim. Zero means
+	// unknown, in which case Search falls back to comparing against the
+	// ANN index's own recorded dimension.
+	embeddingDim int
 }
 
 // NewMemoryTree creates a new tree from a slice of nodes.
@@ -41,6 +53,16 @@ func NewMemoryTree(nodes []MemoryNode) *MemoryTree {
 	return tree
 }
 
+// SetEmbeddingDim records the schema's declared embedding dimension
+// (SchemaInfo.EmbeddingDim), so Search's ANN fallback validates query
+// vectors against the declared schema rather than just the ANN index's
+// own recorded dimension. DecodeWithANN calls this automatically; other
+// callers that construct a MemoryTree directly from a decoded
+// EngramFile can call it to get the same validation.
+func (t *MemoryTree) SetEmbeddingDim(dim int) {
+	t.embeddingDim = dim
+}
+
 // Get returns a node by ID.
 func (t *MemoryTree) Get(id string) *MemoryNode {
 	return t.byID[id]
@@ -93,12 +115,25 @@ type SearchResult struct {
 	Score float32
 }
 
-// Search performs semantic search using cosine similarity.
+// Search performs semantic search using cosine similarity. When an HNSW
+// index is available (built lazily here, via BuildANNIndex, or restored
+// via ImportANNIndex) and its dimension matches queryEmbedding, Search
+// uses approximate nearest-neighbor lookup instead of a linear scan. If
+// SetEmbeddingDim has recorded the schema's declared embedding
+// dimension, a query that doesn't match it falls back to the linear scan
+// without even building an index, rather than trusting the index's own
+// recorded dimension.
 func (t *MemoryTree) Search(queryEmbedding []float32, limit int) []SearchResult {
 	if len(queryEmbedding) == 0 {
 		return nil
 	}
 
+	if t.embeddingDim == 0 || len(queryEmbedding) == t.embeddingDim {
+		if idx := t.ensureANNIndex(); idx != nil && idx.dim == len(queryEmbedding) {
+			return t.searchANN(idx, queryEmbedding, limit)
+		}
+	}
+
 	var results []SearchResult
 	for i := range t.nodes {
 		node := &t.nodes[i]
@@ -7,15 +7,27 @@ import (
 
 // MemoryNode represents a single memory in an Engram file.
 type MemoryNode struct {
-	ID        string     `msgpack:"id"`
-	Content   string     `msgpack:"content"`
-	Embedding []float32  `msgpack:"embedding,omitempty"`
-	Tags      []string   `msgpack:"tags,omitempty"`
-	Entities  []Entity   `msgpack:"entities,omitempty"`
-	Links     []Link     `msgpack:"links,omitempty"`
-	Metadata  NodeMeta   `msgpack:"metadata,omitempty"`
-	Children  []string   `msgpack:"children,omitempty"`
-	ParentID  string     `msgpack:"parentId,omitempty"`
+	ID          string       `msgpack:"id"`
+	Content     string       `msgpack:"content"`
+	Embedding   []float32    `msgpack:"embedding,omitempty"`
+	Tags        []string     `msgpack:"tags,omitempty"`
+	Entities    []Entity     `msgpack:"entities,omitempty"`
+	Links       []Link       `msgpack:"links,omitempty"`
+	Metadata    NodeMeta     `msgpack:"metadata,omitempty"`
+	Children    []string     `msgpack:"children,omitempty"`
+	ParentID    string       `msgpack:"parentId,omitempty"`
+	Attachments []Attachment `msgpack:"attachments,omitempty"`
+}
+
+// Attachment references a binary blob (audio, image, PDF, embedding
+// shard, ...) stored out-of-line from the node's msgpack payload. CID is
+// a content-addressed, algorithm-prefixed multihash such as
+// "sha256-<hex>" or "blake3-<hex>", resolved through a BlobStore.
+type Attachment struct {
+	CID       string                 `msgpack:"cid"`
+	MediaType string                 `msgpack:"mediaType,omitempty"`
+	Size      int64                  `msgpack:"size,omitempty"`
+	Extra     map[string]interface{} `msgpack:"extra,omitempty"`
 }
 
 // Entity represents a named entity extracted from content.
@@ -65,11 +77,20 @@ type SchemaInfo struct {
 	Features       []string `msgpack:"features,omitempty"`
 }
 
-// SecurityInfo contains integrity and encryption information.
+// SecurityInfo contains integrity, encryption, and signing information.
 type SecurityInfo struct {
-	Integrity  string `msgpack:"integrity,omitempty"`
-	Encryption string `msgpack:"encryption,omitempty"`
-	KeyID      string `msgpack:"keyId,omitempty"`
+	Integrity  string      `msgpack:"integrity,omitempty"`
+	Encryption string      `msgpack:"encryption,omitempty"`
+	KeyID      string      `msgpack:"keyId,omitempty"`
+	Signatures []Signature `msgpack:"signatures,omitempty"`
+}
+
+// Signature is a single detached signer entry over an Engram file.
+// Multiple signers (author, publisher, mirror) can co-sign the same file.
+type Signature struct {
+	KeyID     string `msgpack:"keyId"`
+	Algorithm string `msgpack:"algorithm"`
+	Signature []byte `msgpack:"signature"`
 }
 
 // FileMeta contains file-level custom metadata.